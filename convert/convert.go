@@ -0,0 +1,2275 @@
+// Package convert (tries to!) converts a Turbo Pascal AST into Go code.
+package convert
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/check"
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// Options are the optional settings for Convert.
+type Options struct {
+	// If true, emit //line directives before each declaration and
+	// statement so that Go compiler errors, stack traces, and the
+	// like refer to lines in the Pascal source. Nodes whose position
+	// has no filename are attributed to Filename.
+	LineDirectives bool
+	Filename       string
+	// If true, do integer arithmetic in Longint (int32), the widest
+	// intermediate type Turbo Pascal uses, and narrow the result
+	// explicitly when it's assigned, so that intermediate results
+	// like the x * 100 in "x * 100 div 3" don't overflow.
+	TPArith bool
+	// If true, check the range of integer values assigned to smaller
+	// types everywhere, as if compiling with {$R+}. Without this,
+	// range checks are only done in {$R+} regions of the source.
+	RangeChecks bool
+	// If true, functions have Delphi's implicit Result variable, and
+	// it's used as the name of their Go result.
+	ResultVar bool
+}
+
+// Convert writes Go code for the given program or unit to w. Any
+// units it uses should be passed in units so the converter can look
+// up their declarations. If the converter hits something it can't
+// handle, it stops and returns an error (and the output is
+// incomplete). Problems that don't stop the conversion are returned
+// as an ErrorList once the output has been written: errors the
+// checker finds in the source (as *check.Error), which are converted
+// as well as possible, and problems converting it, such as inline
+// machine code (as *Error).
+func Convert(file ast.File, units []*ast.Unit, w io.Writer, options Options) (err error) {
+	var c *converter
+	defer func() {
+		// The converter panics on source it doesn't handle, which
+		// keeps the code simple; turn that into an error here.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("convert error: %v", r)
+			if c != nil && c.errors != nil {
+				// The checker's errors may explain it
+				err = append(c.errors, err)
+			}
+		}
+	}()
+
+	info, err := check.Check(file, units, check.Options{ResultVar: options.ResultVar})
+	c = &converter{
+		w:           w,
+		options:     options,
+		info:        info,
+		atLineStart: true,
+		curSwitches: token.DefaultSwitches,
+		withNames:   make(map[*ast.WithStmt]string),
+		enumNames:   make(map[*ast.ScalarSpec]string),
+
+		recordNames:    make(map[*ast.RecordSpec]string),
+		variantLayouts: make(map[*ast.RecordSpec]*variantLayout),
+		predeclared:    make(map[ast.DeclPart]bool),
+		resultNames:    make(map[*ast.FuncDecl]string),
+		lowered:        make(map[ast.Stmt]bool),
+		bracedWiths:    make(map[*ast.WithStmt]bool),
+	}
+	for _, e := range checkErrors(err, file, units) {
+		c.errors = append(c.errors, e)
+	}
+
+	switch file := file.(type) {
+	case *ast.Program:
+		c.program(file)
+	case *ast.Unit:
+		c.unit(file)
+	default:
+		panic(fmt.Sprintf("unhandled File type: %T", file))
+	}
+	if c.errors != nil {
+		return c.errors
+	}
+	return nil
+}
+
+// Error is a problem converting the source that doesn't stop the
+// conversion, but means the Go code won't behave like the Pascal.
+type Error struct {
+	// Source line/column position where the error occurred.
+	Position token.Position
+	// Error message.
+	Message string
+}
+
+// Error returns a formatted version of the error, including the line
+// and column numbers.
+func (e *Error) Error() string {
+	if e.Position.Filename != "" {
+		return fmt.Sprintf("convert error at %s:%d:%d: %s",
+			e.Position.Filename, e.Position.Line, e.Position.Column, e.Message)
+	}
+	return fmt.Sprintf("convert error at %d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+}
+
+// ErrorList is the type of error Convert returns for the problems it
+// found once the output is written: the checker's errors, then the
+// converter's, each in the order they were found.
+type ErrorList []error
+
+// Error returns all the errors formatted one per line.
+func (e ErrorList) Error() string {
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// checkErrors returns the checker's errors, leaving out those for
+// undeclared names that may be declared in a unit that isn't available
+// (such as Crt and Dos): those in a program or unit that uses such a
+// unit, or in a file it includes. The converter treats these names as
+// being of unknown type.
+func checkErrors(err error, file ast.File, units []*ast.Unit) check.ErrorList {
+	errs, _ := err.(check.ErrorList)
+	available := map[string]bool{"system": true}
+	for _, unit := range units {
+		available[strings.ToLower(unit.Name)] = true
+	}
+	if unit, isUnit := file.(*ast.Unit); isUnit {
+		available[strings.ToLower(unit.Name)] = true
+	}
+	usesMissing := func(uses ...[]string) bool {
+		for _, list := range uses {
+			for _, name := range list {
+				if !available[strings.ToLower(name)] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// Whether each file uses a missing unit, keyed by filename
+	missing := make(map[string]bool)
+	for _, unit := range units {
+		missing[unit.Pos().Filename] = usesMissing(unit.InterfaceUses, unit.ImplementationUses)
+	}
+	var fileMissing bool
+	switch file := file.(type) {
+	case *ast.Program:
+		fileMissing = usesMissing(file.Uses)
+	case *ast.Unit:
+		fileMissing = usesMissing(file.InterfaceUses, file.ImplementationUses)
+	}
+	missing[file.Pos().Filename] = fileMissing
+
+	var kept check.ErrorList
+	for _, e := range errs {
+		inMissing, known := missing[e.Position.Filename]
+		if !known {
+			// An include file, assume it's the main file's
+			inMissing = fileMissing
+		}
+		if inMissing && strings.HasPrefix(e.Message, "undeclared ") {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+type converter struct {
+	w           io.Writer
+	atLineStart bool // true if last char written was a newline
+	options     Options
+	comments    ast.CommentMap
+	switches    ast.SwitchMap
+	curSwitches token.Switches // switch state at current statement
+	info        *check.Info
+	scope       *check.Scope // checker's scope for the current node
+
+	// Names of the variables generated for "with" statements: the
+	// names declared in each enclosing function, and the name used
+	// for each statement
+	withVars  []map[string]bool
+	withNames map[*ast.WithStmt]string
+
+	// Go type names of the enumerated types declared so far, used for
+	// subranges of them
+	enumNames map[*ast.ScalarSpec]string
+
+	// Go type names of the variant record types declared so far, and
+	// the layouts of their variant parts (see variant.go)
+	recordNames    map[*ast.RecordSpec]string
+	variantLayouts map[*ast.RecordSpec]*variantLayout
+
+	// Object method implementation being converted, and its object
+	// type (see object.go), or nil outside methods
+	method ast.DeclPart
+	self   *ast.ObjectSpec
+
+	// Nested procedures and functions declared as func variables
+	// ahead of their definitions, because they're called before
+	// they're defined (see predeclare)
+	predeclared map[ast.DeclPart]bool
+
+	// Names of the Go result variables of the functions being
+	// converted (see resultName)
+	resultNames map[*ast.FuncDecl]string
+
+	// Statements converted with labels and gotos instead of a Go
+	// block, and "with" statements whose variable is declared in a
+	// block of its own, so that gotos are legal in Go (see goto.go);
+	// and the number of labels generated in the current function
+	lowered     map[ast.Stmt]bool
+	bracedWiths map[*ast.WithStmt]bool
+	numLabels   int
+
+	errors ErrorList // problems that don't stop the conversion
+}
+
+func (c *converter) errorf(pos token.Position, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.errors = append(c.errors, &Error{Position: pos, Message: message})
+}
+
+// enterScope makes the scope the checker opened for node (a
+// procedure, function, or "with" statement) the current scope.
+func (c *converter) enterScope(node ast.Node) {
+	c.scope = c.info.Scopes[node]
+	if _, isWith := node.(*ast.WithStmt); !isWith {
+		c.withVars = append(c.withVars, make(map[string]bool))
+	}
+}
+
+func (c *converter) exitScope() {
+	if c.scope.Kind != check.ScopeWith {
+		c.withVars = c.withVars[:len(c.withVars)-1]
+	}
+	c.scope = c.scope.Parent
+}
+
+// isDeclared reports whether name is declared in the current scope,
+// including the variables generated for "with" statements.
+func (c *converter) isDeclared(name string) bool {
+	if c.scope.Lookup(name) != nil {
+		return true
+	}
+	for _, vars := range c.withVars {
+		if vars[strings.ToLower(name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the type of the given expression as worked out by
+// the checker (nil if unknown).
+func (c *converter) typeOf(expr ast.Expr) ast.TypeSpec {
+	return c.info.Types[expr]
+}
+
+// isVarParam reports whether the identifier refers to a "var"
+// parameter, which is a pointer in the Go code.
+func (c *converter) isVarParam(expr *ast.IdentExpr) bool {
+	sym := c.info.Uses[expr]
+	return sym != nil && sym.Kind == check.SymVarParam
+}
+
+// exprName returns the name of the variable or field that a variable
+// expression refers to, for example "Stats" for Board.Stats[i].
+func exprName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.AtExpr:
+		return exprName(expr.Expr)
+	case *ast.DotExpr:
+		return expr.Field
+	case *ast.IdentExpr:
+		return expr.Name
+	case *ast.IndexExpr:
+		return exprName(expr.Array)
+	case *ast.PointerExpr:
+		return exprName(expr.Expr)
+	default:
+		return ""
+	}
+}
+
+func (c *converter) print(a ...interface{}) {
+	c.write(fmt.Sprint(a...))
+}
+
+func (c *converter) printf(format string, a ...interface{}) {
+	c.write(fmt.Sprintf(format, a...))
+}
+
+func (c *converter) write(s string) {
+	if s == "" {
+		return
+	}
+	io.WriteString(c.w, s)
+	c.atLineStart = s[len(s)-1] == '\n'
+}
+
+// Emit a //line directive for the given Pascal source position if
+// that option is enabled. A //line directive must start at the
+// beginning of a line, so don't emit one partway through a line
+// (for example, before the IfStmt of an "else if").
+func (c *converter) lineDirective(pos token.Position) {
+	if !c.options.LineDirectives || pos.Line == 0 || !c.atLineStart {
+		return
+	}
+	filename := pos.Filename
+	if filename == "" {
+		filename = c.options.Filename
+	}
+	c.printf("//line %s:%d\n", filename, pos.Line)
+}
+
+func (c *converter) printChar(b byte) {
+	switch b {
+	case '\\':
+		c.print(`'\\'`)
+	case '\'':
+		c.print(`'\''`)
+	case '\n':
+		c.print(`'\n'`)
+	case '\r':
+		c.print(`'\r'`)
+	case '\t':
+		c.print(`'\t'`)
+	default:
+		if b < 32 || b > 126 {
+			c.printf(`'\x%02x'`, b)
+			return
+		}
+		c.printf("'%c'", b)
+	}
+}
+
+// Print the given node's leading comments, and a //line directive if
+// enabled, ahead of its Go code.
+func (c *converter) startNode(node ast.Node) {
+	c.leadingComments(node)
+	c.lineDirective(node.Pos())
+}
+
+func (c *converter) leadingComments(node ast.Node) {
+	if comments := c.comments[node]; comments != nil {
+		c.commentLines(comments.Leading)
+	}
+}
+
+// Print the given node's end-of-block comments (see ast.Comments).
+func (c *converter) endComments(node ast.Node) {
+	if comments := c.comments[node]; comments != nil {
+		c.commentLines(comments.End)
+	}
+}
+
+// Print the statements of a block, and the comments at its end.
+func (c *converter) block(block *ast.CompoundStmt) {
+	c.stmts(block.Stmts)
+	c.endComments(block)
+}
+
+// Print the given node's trailing comments at the end of the current
+// line (the caller prints the newline).
+func (c *converter) trailingComments(node ast.Node) {
+	comments := c.comments[node]
+	if comments == nil {
+		return
+	}
+	var texts []string
+	for _, comment := range comments.Trailing {
+		texts = append(texts, splitComment(comment.Text)...)
+	}
+	if len(texts) > 0 {
+		c.print(" // ", strings.Join(texts, " "))
+	}
+}
+
+// Print comments as "//" lines, or as a /* */ comment if we're partway
+// through a line. An empty {} comment, which the ZZT source uses as a
+// separator, becomes a blank line.
+func (c *converter) commentLines(comments []*token.Comment) {
+	for _, comment := range comments {
+		lines := splitComment(comment.Text)
+		switch {
+		case !c.atLineStart:
+			if len(lines) > 0 {
+				c.printf("/* %s */ ", strings.Join(lines, " "))
+			}
+		case len(lines) == 0:
+			c.print("\n")
+		default:
+			for _, line := range lines {
+				c.print(strings.TrimRight("// "+line, " "), "\n")
+			}
+		}
+	}
+}
+
+// Split comment text into lines, removing blank lines at the start
+// and end, and the indentation common to the lines after the first.
+func splitComment(text string) []string {
+	lines := strings.Split(strings.Replace(text, "\r", "", -1), "\n")
+	indent := -1
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		lines[i] = line
+		if i == 0 || line == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	lines[0] = strings.TrimLeft(lines[0], " \t")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func (c *converter) program(program *ast.Program) {
+	c.comments = program.Comments
+	c.switches = program.Switches
+	c.commentLines(program.Doc)
+	c.print("package main\n\n")
+	if program.Uses != nil {
+		c.printf("// uses: %s\n\n", strings.Join(program.Uses, ", "))
+	}
+	c.enterScope(program)
+	c.decls(program.Decls, true)
+	c.print("func main() {\n")
+	c.resolveGotos(program.Stmt)
+	c.block(program.Stmt)
+	c.print("}\n")
+	c.exitScope()
+	if comments := c.comments[program]; comments != nil && comments.End != nil {
+		c.print("\n")
+		c.endComments(program)
+	}
+}
+
+func (c *converter) unit(unit *ast.Unit) {
+	c.comments = unit.Comments
+	c.switches = unit.Switches
+	c.commentLines(unit.Doc)
+	c.printf("package main // unit: %s\n\n", unit.Name)
+	if unit.InterfaceUses != nil {
+		c.printf("// interface uses: %s\n\n", strings.Join(unit.InterfaceUses, ", "))
+	}
+	c.enterScope(unit)
+	c.decls(unit.Interface, true)
+	if unit.ImplementationUses != nil {
+		c.printf("\n// implementation uses: %s\n\n", strings.Join(unit.ImplementationUses, ", "))
+	}
+	c.decls(unit.Implementation, true)
+
+	initEmpty := true
+	for _, stmt := range unit.Init.Stmts {
+		if _, isEmpty := stmt.(*ast.EmptyStmt); !isEmpty {
+			initEmpty = false
+		}
+	}
+	if !initEmpty {
+		c.print("func init() {\n")
+		c.resolveGotos(unit.Init)
+		c.block(unit.Init)
+		c.print("}\n")
+	}
+	c.exitScope()
+	if comments := c.comments[unit]; comments != nil && comments.End != nil {
+		c.print("\n")
+		c.endComments(unit)
+	}
+}
+
+func (c *converter) decls(decls []ast.DeclPart, isMain bool) {
+	if !isMain {
+		c.predeclare(decls)
+	}
+	for _, decl := range decls {
+		c.decl(decl, isMain)
+	}
+}
+
+func (c *converter) decl(decl ast.DeclPart, isMain bool) {
+	switch decl := decl.(type) {
+	case *ast.ConstDecls:
+		c.startNode(decl)
+		consts := []*ast.ConstDecl{}
+		vars := []*ast.ConstDecl{}
+		for _, d := range decl.Decls {
+			switch d.Value.(type) {
+			case *ast.ConstArrayExpr, *ast.ConstRecordExpr, *ast.SetExpr:
+				vars = append(vars, d)
+			default:
+				consts = append(consts, d)
+			}
+		}
+		if len(consts) > 0 {
+			if len(consts) == 1 {
+				c.print("const ")
+			} else {
+				c.print("const (\n")
+			}
+			for _, d := range consts {
+				c.startNode(d)
+				c.printf("%s", d.Name)
+				if d.Type != nil {
+					c.print(" ")
+					c.typeSpec(d.Type)
+				}
+				c.print(" = ")
+				c.expr(d.Value)
+				c.trailingComments(d)
+				c.print("\n")
+			}
+			if len(consts) != 1 {
+				c.print(")\n")
+			}
+		}
+		if len(vars) > 0 {
+			if len(vars) == 1 {
+				c.print("var ")
+			} else {
+				c.print("var (\n")
+			}
+			for _, d := range vars {
+				c.startNode(d)
+				c.print(d.Name)
+				if d.Type != nil {
+					c.print(" ")
+					c.typeSpec(d.Type)
+				}
+				c.print(" = ")
+				switch d.Value.(type) {
+				case *ast.ConstRecordExpr:
+					c.typeSpec(d.Type)
+				case *ast.ConstArrayExpr:
+					c.typeSpec(d.Type)
+				}
+				c.expr(d.Value)
+				c.trailingComments(d)
+				c.print("\n")
+			}
+			if len(vars) != 1 {
+				c.print(")\n")
+			}
+			c.variantConstInit(vars, isMain)
+		}
+	case *ast.FuncDecl:
+		if decl.Stmt == nil {
+			c.heading(decl, isMain)
+			return
+		}
+		params, result := decl.Params, decl.Result
+		forward, _ := c.info.Forwards[decl].(*ast.FuncDecl)
+		if forward != nil {
+			params, result = forward.Params, forward.Result
+		}
+		c.startNode(decl)
+		switch {
+		case decl.Object != nil:
+			c.methodStart(decl, decl.Object)
+		case isMain:
+			c.printf("func %s(", decl.Name)
+		case c.predeclared[decl]:
+			c.printf("%s = func(", decl.Name)
+		default:
+			c.printf("%s := func(", decl.Name)
+		}
+		c.params(params)
+		c.resultNames[decl] = c.resultName(decl)
+		c.printf(") (%s ", c.resultNames[decl])
+		c.typeIdent(result)
+		c.print(") {\n")
+
+		c.enterScope(decl)
+		c.rebindParamVMTs(params)
+		c.decls(decl.Decls, false)
+		c.resolveGotos(decl.Stmt)
+		c.block(decl.Stmt)
+		c.exitScope()
+		if decl.Object != nil {
+			c.methodEnd()
+		}
+
+		c.print("return\n}\n\n")
+	case *ast.LabelDecls:
+		// not needed
+	case *ast.ProcDecl:
+		if decl.Stmt == nil {
+			c.heading(decl, isMain)
+			return
+		}
+		params := decl.Params
+		forward, _ := c.info.Forwards[decl].(*ast.ProcDecl)
+		if forward != nil {
+			params = forward.Params
+		}
+		c.startNode(decl)
+		switch {
+		case decl.Object != nil:
+			c.methodStart(decl, decl.Object)
+		case isMain:
+			c.printf("func %s(", decl.Name)
+		case c.predeclared[decl]:
+			c.printf("%s = func(", decl.Name)
+		default:
+			c.printf("%s := func(", decl.Name)
+		}
+		c.params(params)
+		c.print(") {\n")
+
+		c.enterScope(decl)
+		c.rebindParamVMTs(params)
+		c.decls(decl.Decls, false)
+		c.resolveGotos(decl.Stmt)
+		c.block(decl.Stmt)
+		c.exitScope()
+		if decl.Object != nil {
+			c.methodEnd()
+		}
+
+		c.print("}\n\n")
+	case *ast.TypeDefs:
+		c.startNode(decl)
+		if len(decl.Defs) == 1 {
+			c.print("type ")
+		} else {
+			c.print("type (\n")
+		}
+		var scalarType string
+		var scalarConsts []string
+		var variantRecords, objects []*ast.TypeDef
+		for _, d := range decl.Defs {
+			c.startNode(d)
+			c.printf("%s ", d.Name)
+			switch d.Type.(type) {
+			case *ast.SetSpec:
+				// Alias so that the Set methods are available
+				c.print("= ")
+			case *ast.SubrangeSpec:
+				// Alias as subrange values mix freely with the base type
+				c.print("= ")
+			case *ast.PointerSpec:
+				if c.pointerObject(d.Type) != nil {
+					// Alias so that the object's methods are available
+					c.print("= ")
+				}
+			}
+			if spec, ok := d.Type.(*ast.ScalarSpec); ok {
+				scalarType = d.Name
+				scalarConsts = spec.Names
+				c.enumNames[spec] = d.Name
+			}
+			if spec, ok := d.Type.(*ast.RecordSpec); ok && spec.Variant != nil {
+				variantRecords = append(variantRecords, d)
+				c.recordNames[spec] = d.Name
+			}
+			if _, ok := d.Type.(*ast.ObjectSpec); ok {
+				if !isMain {
+					// Go methods can only be declared at the top level
+					panic(fmt.Sprintf("object type %s must be declared at the top level", d.Name))
+				}
+				objects = append(objects, d)
+			}
+			c.typeSpec(d.Type)
+			c.trailingComments(d)
+			c.print("\n")
+		}
+		if len(decl.Defs) != 1 {
+			c.print(")\n")
+		}
+		if scalarConsts != nil {
+			// Add constants from last ScalarSpec "enum". Bit of a
+			// hack, as it only supports one "enum" per defs, but
+			// that's all we need for ZZT source.
+			c.print("const (\n")
+			for i, name := range scalarConsts {
+				c.printf("%s", name)
+				if i == 0 {
+					c.printf(" %s = iota + 1", scalarType)
+				}
+				c.print("\n")
+			}
+			c.print(")\n\n")
+		}
+		for _, d := range variantRecords {
+			c.variantMethods(d.Name, d.Type.(*ast.RecordSpec))
+		}
+		for _, d := range objects {
+			c.objectMethods(d.Name, d.Type.(*ast.ObjectSpec))
+		}
+	case *ast.VarDecls:
+		c.startNode(decl)
+		if len(decl.Decls) == 1 {
+			c.print("var ")
+		} else {
+			c.print("var (\n")
+		}
+		for _, d := range decl.Decls {
+			c.startNode(d)
+			c.printf("%s ", strings.Join(d.Names, ", "))
+			c.typeSpec(d.Type)
+			c.trailingComments(d)
+			c.print("\n")
+		}
+		if len(decl.Decls) != 1 {
+			c.print(")\n")
+		}
+	default:
+		panic(fmt.Sprintf("unhandled DeclPart type: %T", decl))
+	}
+}
+
+// heading writes a procedure or function declared without a body.
+// Headings in a unit's interface and "forward" declarations need
+// nothing, as Go functions can be used before they're defined (and
+// nested ones are predeclared if they're called before they're
+// defined). An "external" routine's code isn't available to convert,
+// so it gets a comment with the Go signature it should have, and the
+// user writes it in Go in another file of the package (next to the
+// runtime in lib.go). An "inline" routine's machine code can't be
+// converted either, so it becomes a stub that panics.
+func (c *converter) heading(decl ast.DeclPart, isMain bool) {
+	var name string
+	var params []*ast.ParamGroup
+	var result *ast.TypeIdent
+	var external bool
+	var inline []ast.Expr
+	switch decl := decl.(type) {
+	case *ast.ProcDecl:
+		name, params = decl.Name, decl.Params
+		external, inline = decl.External, decl.Inline
+	case *ast.FuncDecl:
+		name, params, result = decl.Name, decl.Params, decl.Result
+		external, inline = decl.External, decl.Inline
+	}
+	if !external && inline == nil {
+		return
+	}
+	c.startNode(decl)
+	if external {
+		c.printf("// %s is external (implemented in assembly or another\n", name)
+		c.print("// language), so it must be written in Go in another file of\n")
+		c.print("// this package, alongside the runtime in lib.go:\n//\n")
+		c.printf("//\tfunc %s", name)
+		c.funcSignature(params, result)
+		c.print("\n\n")
+		return
+	}
+	kind := "procedure"
+	if _, isFunc := decl.(*ast.FuncDecl); isFunc {
+		kind = "function"
+	}
+	// Machine code can't be converted, so it's dropped (but the
+	// declaration is kept so that callers still compile)
+	c.errorf(decl.Pos(), "inline machine code of %s %s can't be converted", kind, name)
+	c.printf("// %s was inline machine code: %s\n", name, formatInline(inline))
+	if isMain {
+		c.printf("func %s", name)
+	} else {
+		c.printf("%s := func", name)
+	}
+	c.funcSignature(params, result)
+	c.printf(" {\npanic(\"TODO: %s %s\")\n}\n\n", kind, name)
+}
+
+// formatInline formats the bytes of an "inline" directive as in the
+// Pascal source.
+func formatInline(inline []ast.Expr) string {
+	strs := make([]string, len(inline))
+	for i, expr := range inline {
+		strs[i] = expr.String()
+	}
+	return strings.Join(strs, "/")
+}
+
+// resultName returns the name of the Go result variable for a function:
+// its own name, as in Pascal, unless that would hide the function from
+// recursive calls in its body. With Options.ResultVar, it's Delphi's
+// Result variable. Either way, it's the function's name followed by
+// "Result" if the usual name could refer to something else where the
+// result is used.
+func (c *converter) resultName(decl *ast.FuncDecl) string {
+	switch {
+	case c.options.ResultVar:
+		if c.assignedInNested(decl) {
+			// A nested function's own Result would hide it
+			return decl.Name + "Result"
+		}
+		return "Result"
+	case decl.Object != nil:
+		return decl.Name // recursive calls are qualified with "self."
+	case !c.calledIn([]ast.DeclPart{decl}, decl):
+		return decl.Name
+	}
+	// Avoid hiding a name (including the result of an enclosing
+	// function) that the body can refer to
+	for scope := c.info.Scopes[decl]; scope != nil; scope = scope.Parent {
+		fn, isFunc := scope.Node.(*ast.FuncDecl)
+		if scope.Symbols["result"] != nil || (isFunc && c.resultNames[fn] == "result") {
+			return decl.Name + "Result"
+		}
+	}
+	// And a name declared in a nested procedure, which would hide the
+	// result where the procedure assigns it
+	if c.declaredInNested(decl, "result") {
+		return decl.Name + "Result"
+	}
+	return "result"
+}
+
+// declaredInNested reports whether a procedure or function nested in
+// decl declares the given (lowercase) name.
+func (c *converter) declaredInNested(decl *ast.FuncDecl, name string) bool {
+	found := false
+	for _, part := range decl.Decls {
+		ast.Inspect(part, func(node ast.Node) bool {
+			switch node.(type) {
+			case *ast.ProcDecl, *ast.FuncDecl:
+				scope := c.info.Scopes[node]
+				found = found || (scope != nil && scope.Symbols[name] != nil)
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// assignedInNested reports whether the result of decl is assigned in a
+// procedure or function nested in it.
+func (c *converter) assignedInNested(decl *ast.FuncDecl) bool {
+	found := false
+	for _, part := range decl.Decls {
+		ast.Inspect(part, func(node ast.Node) bool {
+			if assign, isAssign := node.(*ast.AssignStmt); isAssign {
+				ident, isIdent := assign.Var.(*ast.IdentExpr)
+				found = found || (isIdent && c.info.Results[ident] == decl)
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// isFuncName reports whether expr, the target of an assignment, is a
+// function's name (rather than Delphi's Result) as its result.
+func (c *converter) isFuncName(expr ast.Expr) bool {
+	ident, isIdent := expr.(*ast.IdentExpr)
+	if !isIdent || c.info.Results[ident] == nil {
+		return false
+	}
+	sym := c.info.Uses[ident]
+	return sym != nil && sym.Kind == check.SymFunc
+}
+
+// exitResultType returns the result type of the function that an Exit
+// in the current scope returns from.
+func (c *converter) exitResultType() ast.TypeSpec {
+	scope := c.scope
+	for scope != nil && scope.Kind != check.ScopeLocal {
+		scope = scope.Parent // out of "with" scopes
+	}
+	if scope == nil {
+		panic("Exit with a result outside a function")
+	}
+	if fn, isFunc := scope.Node.(*ast.FuncDecl); isFunc {
+		// The function (or method) is declared in the enclosing scope
+		if sym := scope.Parent.Symbols[strings.ToLower(fn.Name)]; sym != nil {
+			if spec, isFunc := sym.Type.(*ast.FuncSpec); isFunc {
+				return &ast.IdentSpec{Type: spec.Result}
+			}
+		}
+	}
+	panic("Exit with a result outside a function")
+}
+
+// predeclare writes a func variable declaration for each nested
+// procedure or function in decls that's called before its definition
+// is complete: by itself, or by a sibling (or a procedure nested in
+// one) defined before it. A Go closure assigned with := isn't in scope
+// in its own body, so these are assigned to the variable instead.
+func (c *converter) predeclare(decls []ast.DeclPart) {
+	var earlier []ast.DeclPart // siblings defined so far, and forwards
+	for _, decl := range decls {
+		var name string
+		var params []*ast.ParamGroup
+		var result *ast.TypeIdent
+		switch d := decl.(type) {
+		case *ast.ProcDecl:
+			earlier = append(earlier, decl)
+			if d.Stmt == nil {
+				continue
+			}
+			name, params = d.Name, d.Params
+			if forward, isProc := c.info.Forwards[decl].(*ast.ProcDecl); isProc {
+				params = forward.Params
+			}
+		case *ast.FuncDecl:
+			earlier = append(earlier, decl)
+			if d.Stmt == nil {
+				continue
+			}
+			name, params, result = d.Name, d.Params, d.Result
+			if forward, isFunc := c.info.Forwards[decl].(*ast.FuncDecl); isFunc {
+				params, result = forward.Params, forward.Result
+			}
+		default:
+			continue
+		}
+		if !c.calledIn(earlier, decl) {
+			continue
+		}
+		c.predeclared[decl] = true
+		c.printf("var %s func", name)
+		c.funcSignature(params, result)
+		c.print("\n")
+	}
+}
+
+// calledIn reports whether any of nodes calls the given procedure or
+// function definition (or its forward declaration). Assigning a
+// function's result isn't a call.
+func (c *converter) calledIn(nodes []ast.DeclPart, decl ast.DeclPart) bool {
+	forward := c.info.Forwards[decl]
+	refersTo := func(node ast.Node) bool {
+		ident, isIdent := node.(*ast.IdentExpr)
+		if !isIdent {
+			return false
+		}
+		sym := c.info.Uses[ident]
+		return sym != nil && sym.Decl != nil &&
+			(sym.Decl == ast.Node(decl) || (forward != nil && sym.Decl == ast.Node(forward)))
+	}
+	found := false
+	for _, node := range nodes {
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.AssignStmt:
+				if refersTo(node.Var) {
+					ast.Inspect(node.Value, func(node ast.Node) bool {
+						found = found || refersTo(node)
+						return !found
+					})
+					return false
+				}
+			default:
+				found = found || refersTo(node)
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// funcSignature writes the parameters and result type of a Go func.
+func (c *converter) funcSignature(params []*ast.ParamGroup, result *ast.TypeIdent) {
+	c.print("(")
+	c.params(params)
+	c.print(")")
+	if result != nil {
+		c.print(" ")
+		c.typeIdent(result)
+	}
+}
+
+func (c *converter) params(params []*ast.ParamGroup) {
+	for i, param := range params {
+		if i > 0 {
+			c.print(", ")
+		}
+		c.print(strings.Join(param.Names, ", "), " ")
+		if param.IsVar {
+			c.print("*")
+		}
+		c.typeIdent(param.Type)
+	}
+}
+
+// basicTypes maps the names of Pascal's builtin types (in lowercase)
+// to the Go types used for them.
+var basicTypes = map[string]string{
+	"boolean":  "bool",
+	"byte":     "byte",
+	"char":     "byte",
+	"comp":     "int64",
+	"double":   "float64",
+	"extended": "float64",
+	"integer":  "int16",
+	"longint":  "int32",
+	"real":     "float64",
+	"shortint": "int8",
+	"single":   "float32",
+	"string":   "string",
+	"word":     "uint16",
+}
+
+func (c *converter) typeIdent(typ *ast.TypeIdent) {
+	refSpec := c.info.Resolve(&ast.IdentSpec{Type: typ})
+	if _, isStr := refSpec.(*ast.StringSpec); isStr {
+		c.print("string")
+		return
+	}
+	s := basicTypes[strings.ToLower(typ.Name)]
+	switch {
+	case strings.EqualFold(typ.Name, "pointer"):
+		s = "*uintptr"
+	case s == "":
+		s = typ.Name
+	}
+	c.print(s)
+}
+
+func (c *converter) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+func (c *converter) stmtNoBraces(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.CompoundStmt:
+		c.block(stmt)
+	default:
+		c.stmt(stmt)
+	}
+}
+
+func (c *converter) stmt(stmt ast.Stmt) {
+	if switches, ok := c.switches[stmt]; ok {
+		c.curSwitches = switches
+	}
+	c.leadingComments(stmt)
+	if _, isEmpty := stmt.(*ast.EmptyStmt); !isEmpty {
+		c.lineDirective(stmt.Pos())
+	}
+	if c.lowered[stmt] {
+		c.lowerStmt(stmt)
+		return
+	}
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if c.variantAssign(stmt.Var, func() { c.assignRhs(stmt.Var, stmt.Value) }) {
+			break
+		}
+		c.varExpr(stmt.Var, false)
+
+		// Simplify expressions like "x := x + n" (but not "f := f + n",
+		// where the second f is a recursive call, or when the sum needs
+		// a range check)
+		binary, isBinary := stmt.Value.(*ast.BinaryExpr)
+		if isBinary && (binary.Op == token.PLUS || binary.Op == token.MINUS) && !c.isSet(stmt.Var) && !c.isFuncName(stmt.Var) && !c.needsRangeCheck(binary, c.typeOf(stmt.Var)) {
+			op, rest := splitAssignOp(stmt.Var, binary)
+			if rest != nil {
+				cnst, isConst := rest.(*ast.ConstExpr)
+				if isConst {
+					intVal, isInt := cnst.Value.(int)
+					if isInt && intVal == 1 {
+						if op == token.PLUS {
+							c.print("++")
+						} else {
+							c.print("--")
+						}
+						break
+					}
+				}
+				c.printf(" %s= ", operatorStr(op))
+				c.assignRhs(stmt.Var, rest)
+				break
+			}
+		}
+		c.print(" = ")
+		c.assignRhs(stmt.Var, stmt.Value)
+		c.rebindVMT(stmt.Var)
+	case *ast.CaseStmt:
+		c.print("switch ")
+		c.expr(stmt.Selector)
+		c.print(" {\n")
+		for _, cas := range stmt.Cases {
+			c.print("case ")
+			c.caseConsts(cas.Consts)
+			c.print(":\n")
+			c.stmtNoBraces(cas.Stmt)
+			c.endComments(cas)
+		}
+		if stmt.Else != nil {
+			c.print("default:\n")
+			c.stmts(stmt.Else)
+			c.endComments(stmt)
+		}
+		c.print("}")
+	case *ast.CompoundStmt:
+		c.print("{\n")
+		c.block(stmt)
+		c.print("}")
+	case *ast.EmptyStmt:
+		// Nothing to output, but don't lose any comments
+		if comments := c.comments[stmt]; comments != nil {
+			c.commentLines(comments.Trailing)
+		}
+		return
+	case *ast.ForStmt:
+		c.printf("for %s = ", stmt.Var.Name)
+		c.assignRhs(stmt.Var, stmt.Initial)
+		// The final value is converted to the type of the variable
+		if stmt.Down {
+			c.printf("; %s >= ", stmt.Var.Name)
+			c.convertValue(stmt.Final, c.exprType(stmt.Var))
+			c.printf("; %s-- {\n", stmt.Var.Name)
+		} else {
+			c.printf("; %s <= ", stmt.Var.Name)
+			c.convertValue(stmt.Final, c.exprType(stmt.Var))
+			c.printf("; %s++ {\n", stmt.Var.Name)
+		}
+		c.stmtNoBraces(stmt.Stmt)
+		c.print("}")
+	case *ast.GotoStmt:
+		c.printf("goto %s", stmt.Label)
+	case *ast.IfStmt:
+		c.print("if ")
+		c.expr(stmt.Cond)
+		c.print(" {\n")
+		c.stmtNoBraces(stmt.Then)
+		c.print("}")
+		if stmt.Else != nil {
+			innerIf, isElseIf := stmt.Else.(*ast.IfStmt)
+			if isElseIf {
+				c.print(" else ")
+				c.stmtNoBraces(innerIf)
+			} else {
+				c.print(" else {\n")
+				c.stmtNoBraces(stmt.Else)
+				c.print("}")
+			}
+		}
+	case *ast.LabelledStmt:
+		c.printf("%s:\n", stmt.Label)
+		c.stmt(stmt.Stmt)
+	case *ast.ProcStmt:
+		if c.objectAlloc(stmt.Proc, stmt.Args, true) {
+			break
+		}
+		procStr := strings.ToLower(stmt.Proc.String())
+		switch procStr {
+		case "dec":
+			if len(stmt.Args) != 1 {
+				panic(fmt.Sprintf("Dec() requires 1 arg, got %d", len(stmt.Args)))
+			}
+			if c.variantAssign(stmt.Args[0], func() { c.expr(stmt.Args[0]); c.print(" - 1") }) {
+				break
+			}
+			c.expr(stmt.Args[0])
+			c.print("--")
+		case "exit":
+			c.print("return")
+			if len(stmt.Args) == 1 {
+				// Exit(value) returns value as the function's result
+				c.print(" ")
+				c.assignValue(c.exitResultType(), stmt.Args[0])
+			}
+		case "include", "exclude":
+			if len(stmt.Args) != 2 {
+				panic(fmt.Sprintf("%s() requires 2 args, got %d", stmt.Proc, len(stmt.Args)))
+			}
+			c.setRecv(stmt.Args[0])
+			if procStr == "include" {
+				c.print(".Include(")
+			} else {
+				c.print(".Exclude(")
+			}
+			c.setElem(stmt.Args[1])
+			c.print(")")
+		case "inc":
+			if len(stmt.Args) != 1 {
+				panic(fmt.Sprintf("Inc() requires 1 arg, got %d", len(stmt.Args)))
+			}
+			if c.variantAssign(stmt.Args[0], func() { c.expr(stmt.Args[0]); c.print(" + 1") }) {
+				break
+			}
+			c.expr(stmt.Args[0])
+			c.print("++")
+		case "str":
+			if widthExpr, isWidth := stmt.Args[0].(*ast.WidthExpr); isWidth {
+				c.expr(stmt.Args[1])
+				c.print(" = StrWidth(")
+				c.procArg(false, check.Integer, stmt.Args[0])
+				c.printf(", %d", widthExpr.Width.(*ast.ConstExpr).Value.(int))
+				c.print(")")
+			} else {
+				c.expr(stmt.Args[1])
+				c.print(" = Str(")
+				c.procArg(false, check.Integer, stmt.Args[0])
+				c.print(")")
+			}
+		case "val":
+			c.expr(stmt.Args[1])
+			c.print(" = ")
+			targetType := c.basicType(c.typeOf(stmt.Args[1]))
+			convert := targetType != "" && targetType != "int16"
+			if convert {
+				c.printf("%s(", targetType)
+			}
+			c.print("Val(")
+			c.procArg(false, check.String, stmt.Args[0])
+			c.print(", ")
+			c.procArg(true, check.Integer, stmt.Args[2])
+			c.print(")")
+			if convert {
+				c.print(")")
+			}
+		default:
+			if procStr == "delete" {
+				c.varExpr(stmt.Args[0], false)
+				c.print(" = ")
+			}
+			if procStr == "writeln" {
+				c.print("WriteLn") // It's sometimes spelled Writeln in the Pascal
+			} else {
+				c.varExpr(stmt.Proc, false)
+			}
+			var params []*ast.ParamGroup
+			if spec, isProc := c.typeOf(stmt.Proc).(*ast.ProcSpec); isProc {
+				params = spec.Params
+			}
+			c.print("(")
+			if procStr == "writeln" {
+				c.writeArgs(stmt.Args)
+			} else {
+				c.procArgs(params, stmt.Args)
+			}
+			c.print(")")
+			if c.curSwitches.On('I') && c.isIOProc(procStr, stmt.Args) {
+				// In the {$I+} state, a failed I/O operation is a
+				// runtime error rather than setting IOResult
+				c.print("\nCheckIO()")
+			}
+		}
+	case *ast.RepeatStmt:
+		c.print("for {\n")
+		c.stmts(stmt.Stmts)
+		c.print("if ")
+		c.expr(stmt.Cond)
+		c.print(" {\nbreak\n}\n}")
+	case *ast.WhileStmt:
+		c.print("for ")
+		c.expr(stmt.Cond)
+		c.print(" {\n")
+		c.stmtNoBraces(stmt.Stmt)
+		c.print("}")
+	case *ast.WithStmt:
+		switch c.typeOf(stmt.Var).(type) {
+		case *ast.RecordSpec, *ast.ObjectSpec:
+		default:
+			panic(fmt.Sprintf("'with' statement var not a known record: %s", stmt.Var))
+		}
+		var withName string
+		if identExpr, isIdent := stmt.Var.(*ast.IdentExpr); isIdent {
+			withName = identExpr.Name
+		} else {
+			if c.bracedWiths[stmt] {
+				// A goto jumps over this, so declare the variable in a
+				// block of its own (see resolveGotos)
+				c.print("{\n")
+			}
+			withName = c.makeWithName(exprName(stmt.Var))
+			c.printf("%s := &", withName)
+			c.varExpr(stmt.Var, false)
+			c.print("\n")
+			c.withVars[len(c.withVars)-1][strings.ToLower(withName)] = true
+		}
+		c.withNames[stmt] = withName
+		c.enterScope(stmt)
+		c.stmtNoBraces(stmt.Stmt)
+		c.exitScope()
+		if c.bracedWiths[stmt] {
+			c.print("}\n")
+		}
+		return
+	default:
+		panic(fmt.Sprintf("unhandled Stmt: %T", stmt))
+	}
+	c.trailingComments(stmt)
+	c.print("\n")
+}
+
+// caseConsts prints the constants of a "case" statement element.
+func (c *converter) caseConsts(consts []ast.Expr) {
+	if rangeExpr, ok := consts[0].(*ast.RangeExpr); ok {
+		// Making a lot of assumptions here, but this is the only
+		// way it's used in the ZZT source.
+		min := rangeExpr.Min.(*ast.ConstExpr).Value.(string)[0]
+		max := rangeExpr.Max.(*ast.ConstExpr).Value.(string)[0]
+		for i, b := 0, min; b <= max; i, b = i+1, b+1 {
+			if i > 0 {
+				c.print(", ")
+			}
+			c.printf("'%c'", b)
+		}
+	} else {
+		c.exprs(consts)
+	}
+}
+
+// isIOProc reports whether the named procedure (called with the given
+// args) is a file operation that sets IOResult.
+func (c *converter) isIOProc(procStr string, args []ast.Expr) bool {
+	switch procStr {
+	case "append", "blockread", "blockwrite", "chdir", "close", "erase",
+		"mkdir", "rename", "reset", "rewrite", "rmdir", "seek", "truncate":
+		return true
+	case "read", "readln", "write", "writeln":
+		// Only if reading or writing a file rather than the console
+		if len(args) == 0 {
+			return false
+		}
+		_, isFile := c.typeOf(args[0]).(*ast.FileSpec)
+		return isFile
+	}
+	return false
+}
+
+// splitAssignOp checks whether value is of the form "v + a" or
+// "v - a", where v is the assignment target, and if so returns the
+// operator and the other operand so the assignment can be written as
+// "v += a". It returns a nil Expr if not. Longer sums like "v + a + b"
+// aren't split, as re-associating them can change the result's type.
+func splitAssignOp(v ast.Expr, value *ast.BinaryExpr) (token.Token, ast.Expr) {
+	if v.String() == value.Left.String() {
+		return value.Op, value.Right
+	}
+	return token.ILLEGAL, nil
+}
+
+func (c *converter) assignRhs(left ast.Expr, right ast.Expr) {
+	c.assignValue(c.typeOf(left), right)
+}
+
+// assignValue writes right as a value of the given type, converting it
+// if needed.
+func (c *converter) assignValue(typ ast.TypeSpec, right ast.Expr) {
+	if c.upcast(typ, false, right) {
+		return
+	}
+	if c.rangeCheck(right, typ) {
+		return
+	}
+	if parenExpr, isParen := right.(*ast.ParenExpr); isParen {
+		right = parenExpr.Expr
+	}
+	c.convertValue(right, c.basicType(typ))
+}
+
+// convertValue writes expr as a value of the Go type goType (see
+// basicType), converting it if it's of a different type.
+func (c *converter) convertValue(expr ast.Expr, goType string) {
+	from := c.exprType(expr)
+	if goType == "string" {
+		if cnst, isConst := expr.(*ast.ConstExpr); isConst {
+			if str, isStr := cnst.Value.(string); isStr {
+				c.printf("%q", str)
+				return
+			}
+		}
+		if from == "byte" {
+			// A Char in Go is a byte
+			c.print("string([]byte{")
+			c.expr(expr)
+			c.print("})")
+			return
+		}
+	}
+	if from == "" || goType == "" || from == goType {
+		c.expr(expr)
+		return
+	}
+	c.printf("%s(", goType)
+	c.expr(expr)
+	c.print(")")
+}
+
+func (c *converter) procArgs(params []*ast.ParamGroup, args []ast.Expr) {
+	isVars := []bool{}
+	specs := []ast.TypeSpec{}
+	for _, group := range params {
+		for range group.Names {
+			isVars = append(isVars, group.IsVar)
+			specs = append(specs, &ast.IdentSpec{Type: group.Type})
+		}
+	}
+	for i, arg := range args {
+		if i > 0 {
+			c.print(", ")
+		}
+		if params != nil {
+			c.procArg(isVars[i], specs[i], arg)
+		} else {
+			c.procArg(false, nil, arg)
+		}
+	}
+}
+
+// writeArgs prints the arguments of a WriteLn call. Chars are bytes
+// in Go, so they're passed as strings to print as characters rather
+// than numbers.
+func (c *converter) writeArgs(args []ast.Expr) {
+	for i, arg := range args {
+		if i > 0 {
+			c.print(", ")
+		}
+		if c.info.Underlying(c.info.Resolve(c.typeOf(arg))) != check.Char {
+			c.procArg(false, nil, arg)
+			continue
+		}
+		if cnst, isConst := arg.(*ast.ConstExpr); isConst {
+			c.printf("%q", cnst.Value)
+			continue
+		}
+		c.print("Chr(")
+		c.expr(arg)
+		c.print(")")
+	}
+}
+
+// procArg writes an argument for a parameter of the given type, as a
+// pointer if it's a var parameter. Builtin procedures without a
+// declared signature have a nil type, and their arguments are passed
+// as their own type (narrowed if their arithmetic was done wider).
+func (c *converter) procArg(targetIsVar bool, target ast.TypeSpec, arg ast.Expr) {
+	if targetIsVar && c.variantField(arg) != nil {
+		panic(fmt.Sprintf("variant field %s can't be passed as a var parameter", arg))
+	}
+	if c.upcast(target, targetIsVar, arg) {
+		return
+	}
+	if !targetIsVar {
+		if target == nil {
+			target = c.typeOf(arg)
+		}
+		if !c.rangeCheck(arg, target) {
+			c.convertValue(arg, c.basicType(target))
+		}
+		return
+	}
+	switch arg := arg.(type) {
+	case *ast.IdentExpr:
+		if !c.isVarParam(arg) {
+			c.print("&")
+		}
+		c.identExpr(arg) // a var parameter's pointer is passed straight through
+	case *ast.AtExpr, *ast.DotExpr, *ast.IndexExpr, *ast.PointerExpr, *ast.FuncExpr:
+		c.print("&")
+		c.expr(arg)
+	default:
+		c.expr(arg)
+	}
+}
+
+func (c *converter) makeWithName(name string) string {
+	parts := splitCamel(name)
+	lastPart := parts[len(parts)-1]
+	withName := strings.ToLower(strings.TrimSuffix(lastPart, "s"))
+	if !c.isDeclared(withName) {
+		return withName
+	}
+	for i := 2; i < 10; i++ {
+		numName := withName + fmt.Sprint(i)
+		if !c.isDeclared(numName) {
+			return numName
+		}
+	}
+	panic(fmt.Sprintf("too many tries generating 'with' name: %s", withName))
+}
+
+func splitCamel(name string) []string {
+	parts := []string{}
+	hadCap := false
+	start := 0
+	for i, c := range name {
+		if hadCap && c >= 'a' && c <= 'z' && i > 1 {
+			parts = append(parts, name[start:i-1])
+			start = i - 1
+		}
+		hadCap = c >= 'A' && c <= 'Z'
+	}
+	parts = append(parts, name[start:])
+	return parts
+}
+
+func (c *converter) exprs(exprs []ast.Expr) {
+	for i, expr := range exprs {
+		if i > 0 {
+			c.print(", ")
+		}
+		c.expr(expr)
+	}
+}
+
+// isLogical reports whether expr is an "and", "or", or "xor" of
+// Booleans rather than a bitwise operation on integers.
+func (c *converter) isLogical(expr *ast.BinaryExpr) bool {
+	if expr.Op != token.AND && expr.Op != token.OR && expr.Op != token.XOR {
+		return false
+	}
+	return !c.isInteger(expr.Left) && !c.isInteger(expr.Right)
+}
+
+// isInteger reports whether expr is of an integer type (or a subrange
+// of one).
+func (c *converter) isInteger(expr ast.Expr) bool {
+	return check.IsInteger(c.info.Underlying(c.typeOf(expr)))
+}
+
+// isStringOp reports whether expr is a string concatenation or a
+// comparison of strings, whose operands are written as Go strings.
+func (c *converter) isStringOp(expr *ast.BinaryExpr) bool {
+	if expr.Op == token.PLUS {
+		return c.basicType(c.typeOf(expr)) == "string"
+	}
+	return isComparison(expr.Op) && (c.exprType(expr.Left) == "string" || c.exprType(expr.Right) == "string")
+}
+
+func (c *converter) expr(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.BinaryExpr:
+		if expr.Op == token.IN {
+			c.inExpr(expr)
+			return
+		}
+		if c.isSet(expr.Left) || c.isSet(expr.Right) {
+			c.setBinaryExpr(expr)
+			return
+		}
+		if c.isLogical(expr) {
+			c.expr(expr.Left)
+			c.printf(" %s ", logicalOperatorStr(expr.Op))
+			c.expr(expr.Right)
+			return
+		}
+		opStr := operatorStr(expr.Op)
+		switch {
+		case c.isStringOp(expr):
+			c.convertValue(expr.Left, "string")
+			c.printf(" %s ", opStr)
+			c.convertValue(expr.Right, "string")
+		case c.info.Operands[expr] != nil:
+			// Convert operands to the type the operation is done in
+			goType := c.basicType(c.arithType(expr))
+			if constType := c.constCompareType(expr); constType != "" {
+				goType = constType
+			}
+			c.operand(expr.Left, goType)
+			c.printf(" %s ", opStr)
+			c.operand(expr.Right, goType)
+		default:
+			c.expr(expr.Left)
+			c.printf(" %s ", opStr)
+			c.expr(expr.Right)
+		}
+	case *ast.ConstExpr:
+		switch value := expr.Value.(type) {
+		case string:
+			if len(value) == 1 {
+				c.printChar(value[0])
+			} else {
+				c.printf("%q", value)
+			}
+		case float64:
+			s := fmt.Sprintf("%g", value)
+			if !strings.Contains(s, ".") {
+				s += ".0"
+			}
+			c.print(s)
+		case nil:
+			c.print("nil")
+		default:
+			if expr.IsHex {
+				c.printf("0x%02X", value)
+			} else {
+				c.printf("%v", value)
+			}
+		}
+	case *ast.ConstArrayExpr:
+		c.print("{")
+		c.exprs(expr.Values)
+		c.print("}")
+	case *ast.ConstRecordExpr:
+		// Variant fields are set by variantConstInit
+		record, _ := c.typeOf(expr).(*ast.RecordSpec)
+		c.print("{")
+		i := 0
+		for _, field := range expr.Fields {
+			if record != nil && record.Variant != nil && c.variantLayout(record).ByName[strings.ToLower(field.Name)] != nil {
+				continue
+			}
+			if i > 0 {
+				c.print(", ")
+			}
+			i++
+			c.print(field.Name)
+			c.print(": ")
+			c.expr(field.Value)
+		}
+		c.print("}")
+	case *ast.FuncExpr:
+		if c.objectAlloc(expr.Func, expr.Args, false) {
+			break
+		}
+		c.varExpr(expr.Func, false)
+		var params []*ast.ParamGroup
+		if spec, isFunc := c.typeOf(expr.Func).(*ast.FuncSpec); isFunc {
+			params = spec.Params
+		}
+		c.print("(")
+		c.procArgs(params, expr.Args)
+		c.print(")")
+	case *ast.ParenExpr:
+		c.print("(")
+		c.expr(expr.Expr)
+		c.print(")")
+	case *ast.RangeExpr:
+		panic("unexpected RangeExpr: should be handled by 'case' and 'in'")
+	case *ast.SetExpr:
+		c.setExpr(expr)
+	case *ast.TypeConvExpr:
+		if c.exprType(expr.Expr) == "bool" {
+			c.printf("BoolToInt(")
+			c.expr(expr.Expr)
+			c.print(")")
+			break
+		}
+		if expr.Type.String() == "Boolean" {
+			c.print("(")
+			c.expr(expr.Expr)
+			c.print(" != 0)")
+			break
+		}
+		c.typeIdent(expr.Type)
+		c.print("(")
+		c.expr(expr.Expr)
+		c.print(")")
+	case *ast.UnaryExpr:
+		if expr.Op == token.NOT && c.isInteger(expr.Expr) {
+			c.print("^") // bitwise not
+		} else {
+			c.print(operatorStr(expr.Op))
+		}
+		c.expr(expr.Expr)
+	case *ast.AtExpr, *ast.DotExpr, *ast.IdentExpr, *ast.IndexExpr, *ast.PointerExpr:
+		c.varExpr(expr, false)
+		// Add parens if it's actually a function call
+		if _, isFunc := c.typeOf(expr).(*ast.FuncSpec); isFunc {
+			// Pascal allows function call without parens
+			c.print("()")
+		}
+	case *ast.WidthExpr:
+		// Width itself is handled in ProcStmt "str" case
+		c.expr(expr.Expr)
+	default:
+		panic(fmt.Sprintf("unexpected Expr type %T", expr))
+	}
+}
+
+func (c *converter) identExpr(expr *ast.IdentExpr) {
+	if fn := c.info.Results[expr]; fn != nil {
+		c.print(c.resultNames[fn])
+		return
+	}
+	// If record field name is being used inside "with"
+	// statement, prefix it with the with expression and ".".
+	sym := c.info.Uses[expr]
+	if field := c.variantField(expr); field != nil {
+		c.variantRead(expr, field, nil)
+		return
+	}
+	if sym != nil && sym.Scope != nil && sym.Scope.Kind == check.ScopeWith {
+		withStmt := sym.Scope.Node.(*ast.WithStmt)
+		c.print(c.withNames[withStmt])
+		if object := c.objectOf(c.typeOf(withStmt.Var)); object != nil {
+			c.print(c.vmtPath(object, sym))
+		}
+		c.print(".")
+	}
+	// Likewise for an object's fields and methods in its methods
+	if sym != nil && sym.Scope != nil && sym.Scope.Kind == check.ScopeObject {
+		if sym.Kind == check.SymVarParam {
+			c.print("self") // Self
+			return
+		}
+		c.memberPrefix(sym)
+	}
+	c.print(expr.Name)
+}
+
+func (c *converter) typeConversion(expr ast.Expr, typeName string) {
+	if parenExpr, isParen := expr.(*ast.ParenExpr); isParen {
+		c.printf("%s(", typeName)
+		c.expr(parenExpr.Expr)
+		c.print(")")
+	} else {
+		c.printf("%s(", typeName)
+		c.expr(expr)
+		c.print(")")
+	}
+}
+
+// operand writes an operand of an arithmetic expression or comparison,
+// converting it to the given Go type if it's of a different type.
+func (c *converter) operand(expr ast.Expr, goType string) {
+	from := c.exprType(expr)
+	if from != "" && goType != "" && from != goType {
+		c.typeConversion(expr, goType)
+		return
+	}
+	c.expr(expr)
+}
+
+// constCompareType returns the Go type of the other operand of a
+// comparison with an untyped integer constant, if the constant's value
+// is in that type's range, as comparing in that type gives the same
+// result without converting the operand. Otherwise it returns "".
+func (c *converter) constCompareType(expr *ast.BinaryExpr) string {
+	if !isComparison(expr.Op) {
+		return ""
+	}
+	operands := []ast.Expr{expr.Left, expr.Right}
+	for i, operand := range operands {
+		value, isConst := c.info.IntValue(operands[1-i])
+		goType := c.exprType(operand)
+		r, isInt := intRanges[goType]
+		if isConst && c.exprType(operands[1-i]) == "" && isInt && int64(value) >= r.min && int64(value) <= r.max {
+			return goType
+		}
+	}
+	return ""
+}
+
+func (c *converter) varExpr(expr ast.Expr, suppressStar bool) {
+	identExpr, isIdent := expr.(*ast.IdentExpr)
+	isVar := isIdent && c.isVarParam(identExpr)
+	if isVar && !suppressStar {
+		c.printf("*")
+	} else if atExpr, isAt := expr.(*ast.AtExpr); isAt {
+		c.printf("&")
+		expr = atExpr.Expr
+	}
+	switch expr := expr.(type) {
+	case *ast.AtExpr:
+		c.print("&")
+		c.varExpr(expr.Expr, suppressStar)
+	case *ast.DotExpr:
+		if field := c.variantField(expr); field != nil {
+			c.variantRead(expr, field, nil)
+			break
+		}
+		if c.isInheritedCall(expr) {
+			c.inheritedCall(expr)
+			break
+		}
+		c.varExpr(expr.Record, true)
+		if object := c.objectOf(c.typeOf(expr.Record)); object != nil {
+			c.print(c.vmtPath(object, c.info.Fields[expr]))
+		}
+		c.printf(".%s", expr.Field)
+	case *ast.IdentExpr:
+		c.identExpr(expr)
+	case *ast.IndexExpr:
+		if field := c.variantField(expr.Array); field != nil {
+			c.variantRead(expr.Array, field, expr.Index)
+			break
+		}
+		c.varExpr(expr.Array, suppressStar)
+
+		spec := c.typeOf(expr.Array)
+		if spec == nil {
+			panic(fmt.Sprintf("array not found: %s", expr.Array))
+		}
+
+		min := 0
+		switch spec := spec.(type) {
+		case *ast.ArraySpec:
+			min = c.arrayMin(spec)
+		case *ast.StringSpec:
+			min = 1
+		case *ast.IdentSpec:
+			if strings.ToLower(spec.Type.Name) == "string" {
+				min = 1
+			}
+		}
+
+		c.print("[")
+		offset := fmt.Sprintf(" - %d", min)
+		if min < 0 {
+			offset = fmt.Sprintf(" + %d", -min)
+		}
+		// Work out the offset index for signed literals like -1 too
+		signed, isSigned := c.info.IntValue(expr.Index)
+		if _, isUnary := expr.Index.(*ast.UnaryExpr); !isUnary {
+			isSigned = false
+		}
+		if min != 0 {
+			switch index := expr.Index.(type) {
+			case *ast.ConstExpr:
+				val, isInt := index.Value.(int)
+				if !isInt {
+					val = int(index.Value.(string)[0]) // Char index
+				}
+				c.printf("%d", val-min)
+			case *ast.AtExpr, *ast.DotExpr, *ast.FuncExpr, *ast.IdentExpr, *ast.IndexExpr,
+				*ast.ParenExpr, *ast.PointerExpr, *ast.TypeConvExpr, *ast.UnaryExpr:
+				if isSigned {
+					c.printf("%d", signed-min)
+					break
+				}
+				c.expr(expr.Index)
+				c.print(offset)
+			default:
+				c.print("(")
+				c.expr(expr.Index)
+				c.print(")", offset)
+			}
+		} else {
+			c.expr(expr.Index)
+		}
+		c.print("]")
+	case *ast.PointerExpr:
+		if !isVar && !suppressStar {
+			c.print("*")
+		}
+		c.varExpr(expr.Expr, suppressStar)
+	case *ast.FuncExpr:
+		c.expr(expr)
+	default:
+		panic(fmt.Sprintf("unexpected varExpr type: %T", expr))
+	}
+}
+
+func (c *converter) inExpr(expr *ast.BinaryExpr) {
+	values, isSetExpr := expr.Right.(*ast.SetExpr)
+	if !isSetExpr {
+		// Set variable or expression: check its bit
+		c.setRecv(expr.Right)
+		c.print(".Contains(")
+		c.setElem(expr.Left)
+		c.print(")")
+		return
+	}
+	if len(values.Values) == 0 {
+		c.print("false")
+		return
+	}
+	c.print("(")
+	for i, value := range values.Values {
+		if i > 0 {
+			c.print(" || ")
+		}
+		if rangeExpr, ok := value.(*ast.RangeExpr); ok {
+			c.expr(expr.Left)
+			c.print(">=")
+			c.expr(rangeExpr.Min)
+			c.print(" && ")
+			c.expr(expr.Left)
+			c.print("<=")
+			c.expr(rangeExpr.Max)
+		} else {
+			c.expr(expr.Left)
+			c.print("==")
+			c.expr(value)
+		}
+	}
+	c.print(")")
+}
+
+// isSet reports whether expr is of a set type.
+func (c *converter) isSet(expr ast.Expr) bool {
+	_, isSet := c.typeOf(expr).(*ast.SetSpec)
+	return isSet
+}
+
+// setExpr writes a set constructor like [a, b..c] as a Set value.
+func (c *converter) setExpr(expr *ast.SetExpr) {
+	c.print("SetOf(")
+	var ranges []*ast.RangeExpr
+	i := 0
+	for _, value := range expr.Values {
+		if rangeExpr, isRange := value.(*ast.RangeExpr); isRange {
+			ranges = append(ranges, rangeExpr)
+			continue
+		}
+		if i > 0 {
+			c.print(", ")
+		}
+		c.setElem(value)
+		i++
+	}
+	c.print(")")
+	for _, rangeExpr := range ranges {
+		c.print(".WithRange(")
+		c.setElem(rangeExpr.Min)
+		c.print(", ")
+		c.setElem(rangeExpr.Max)
+		c.print(")")
+	}
+}
+
+// setBinaryExpr writes a set operation (union, difference,
+// intersection, or comparison) as a call to the Set method.
+func (c *converter) setBinaryExpr(expr *ast.BinaryExpr) {
+	left, right := expr.Left, expr.Right
+	var method string
+	switch expr.Op {
+	case token.PLUS:
+		method = "Union"
+	case token.MINUS:
+		method = "Diff"
+	case token.STAR:
+		method = "Intersect"
+	case token.LTE:
+		method = "SubsetOf"
+	case token.GTE:
+		method = "SubsetOf"
+		left, right = right, left
+	case token.EQUALS, token.NOT_EQUALS:
+		// Set is an array, so Go's == and != work
+		c.expr(left)
+		c.printf(" %s ", operatorStr(expr.Op))
+		c.expr(right)
+		return
+	default:
+		panic(fmt.Sprintf("unexpected set operator: %s", expr.Op))
+	}
+	c.setRecv(left)
+	c.printf(".%s(", method)
+	c.expr(right)
+	c.print(")")
+}
+
+// setRecv writes a set expression that a Set method is called on. A
+// var parameter is a *Set, which Go dereferences for method calls.
+func (c *converter) setRecv(expr ast.Expr) {
+	if identExpr, isIdent := expr.(*ast.IdentExpr); isIdent && c.isVarParam(identExpr) {
+		c.identExpr(identExpr)
+		return
+	}
+	if binary, isBinary := expr.(*ast.BinaryExpr); isBinary {
+		// Method call binds tighter than any operator
+		c.print("(")
+		c.expr(binary)
+		c.print(")")
+		return
+	}
+	c.expr(expr)
+}
+
+// setElem writes a set element value as an int.
+func (c *converter) setElem(expr ast.Expr) {
+	if _, isConst := expr.(*ast.ConstExpr); isConst {
+		c.expr(expr)
+		return
+	}
+	c.typeConversion(expr, "int")
+}
+
+func (c *converter) typeSpec(spec ast.TypeSpec) {
+	switch spec := spec.(type) {
+	case *ast.FuncSpec:
+		c.print("func(")
+		c.params(spec.Params)
+		c.print(") ")
+		c.typeIdent(spec.Result)
+	case *ast.ProcSpec:
+		c.print("func(")
+		c.params(spec.Params)
+		c.print(")")
+	case *ast.ScalarSpec:
+		// spec.Names are defined by TypeDefs handling
+		c.print("uint8")
+	case *ast.SubrangeSpec:
+		base := c.info.Underlying(spec)
+		if base == nil {
+			panic(fmt.Sprintf("subrange bounds not constant: %s", spec))
+		}
+		if scalar, isEnum := base.(*ast.ScalarSpec); isEnum && c.enumNames[scalar] != "" {
+			c.print(c.enumNames[scalar])
+			break
+		}
+		c.typeSpec(base)
+	case *ast.IdentSpec:
+		c.typeIdent(spec.Type)
+	case *ast.StringSpec:
+		c.print("string")
+	case *ast.ArraySpec:
+		if spec.Index != nil {
+			min, max, ok := c.info.Bounds(spec.Index)
+			if !ok {
+				panic(fmt.Sprintf("array index type has no bounds: %s", spec.Index))
+			}
+			c.printf("[%d]", max-min+1)
+			c.typeSpec(spec.Of)
+			break
+		}
+		min := c.arrayMin(spec)
+		max, maxIsConst := c.info.IntValue(spec.Max)
+		if _, isIdent := spec.Max.(*ast.IdentExpr); isIdent {
+			maxIsConst = false // keep the constant's name in the Go code
+		}
+		if maxIsConst {
+			c.printf("[%d]", max-min+1)
+		} else {
+			c.print("[")
+			c.expr(spec.Max)
+			switch {
+			case min < 1:
+				c.printf("+%d", 1-min)
+			case min > 1:
+				c.printf("-%d", min-1)
+			}
+			c.print("]")
+		}
+		c.typeSpec(spec.Of)
+	case *ast.RecordSpec:
+		c.print("struct {\n")
+		c.fieldSections(spec.Sections)
+		if spec.Variant != nil {
+			if c.recordNames[spec] == "" {
+				// Accessor methods need a named type
+				panic("variant record must be declared as a named type")
+			}
+			if spec.Variant.Tag != "" {
+				c.print(spec.Variant.Tag, " ")
+				c.typeIdent(spec.Variant.Type)
+				c.print("\n")
+			}
+			c.printf("variant [%d]byte // variant part, see accessor methods\n", c.variantLayout(spec).Size)
+		}
+		c.print("}")
+	case *ast.FileSpec:
+		c.print("*File")
+	case *ast.PointerSpec:
+		c.print("*")
+		c.typeIdent(spec.Type)
+	case *ast.SetSpec:
+		c.print("Set")
+	case *ast.ObjectSpec:
+		c.objectStruct(spec)
+	default:
+		c.printf("%s", spec)
+	}
+}
+
+// fieldSections writes the fields of a record or object type.
+func (c *converter) fieldSections(sections []*ast.RecordSection) {
+	for _, section := range sections {
+		c.startNode(section)
+		c.print(strings.Join(section.Names, ", "), " ")
+		c.typeSpec(section.Type)
+		c.trailingComments(section)
+		c.print("\n")
+	}
+}
+
+func operatorStr(op token.Token) string {
+	switch op {
+	case token.EQUALS:
+		return "=="
+	case token.NOT_EQUALS:
+		return "!="
+	case token.OR:
+		return "|"
+	case token.XOR:
+		return "^"
+	case token.DIV:
+		return "/"
+	case token.MOD:
+		return "%"
+	case token.AND:
+		return "&"
+	case token.SHL:
+		return "<<"
+	case token.SHR:
+		return ">>"
+	case token.NOT:
+		return "!"
+	default:
+		// same as in Pascal
+		return op.String()
+	}
+}
+
+func isMathOp(op token.Token) bool {
+	switch op {
+	case token.PLUS, token.MINUS, token.OR, token.XOR, token.STAR, token.SLASH, token.DIV, token.MOD, token.AND, token.SHL, token.SHR:
+		return true
+	}
+	return false
+}
+
+func isComparison(op token.Token) bool {
+	switch op {
+	case token.EQUALS, token.NOT_EQUALS, token.LESS, token.LTE, token.GREATER, token.GTE:
+		return true
+	}
+	return false
+}
+
+func logicalOperatorStr(op token.Token) string {
+	switch op {
+	case token.AND:
+		return "&&"
+	case token.OR:
+		return "||"
+	case token.XOR:
+		return "!="
+	default:
+		panic(fmt.Sprintf("unexpected operator: %s", op))
+	}
+}
+
+// intRanges holds the ranges of Go's integer types.
+var intRanges = map[string]struct{ min, max int64 }{
+	"int8":   {-128, 127},
+	"byte":   {0, 255},
+	"int16":  {-32768, 32767},
+	"uint16": {0, 65535},
+	"int32":  {-2147483648, 2147483647},
+	"int64":  {-9223372036854775808, 9223372036854775807},
+}
+
+// arithType returns the type that the arithmetic or comparison in expr
+// is done in (see check.Info.Operands), or nil if it's not on numbers.
+// With Options.TPArith, integer arithmetic is done in Longint.
+func (c *converter) arithType(expr *ast.BinaryExpr) ast.TypeSpec {
+	typ := c.info.Operands[expr]
+	if c.options.TPArith && typ != check.UntypedInt && check.IsInteger(typ) {
+		return check.Longint
+	}
+	return typ
+}
+
+// rangeCheck writes expr converted to the target type with a range
+// check, if range checks are on and the value may not fit. It returns
+// false if no check is needed and nothing was written.
+func (c *converter) rangeCheck(expr ast.Expr, target ast.TypeSpec) bool {
+	if !c.needsRangeCheck(expr, target) {
+		return false
+	}
+	if parenExpr, isParen := expr.(*ast.ParenExpr); isParen {
+		expr = parenExpr.Expr
+	}
+	to := c.basicType(target)
+	if sub, isSubrange := c.info.Resolve(target).(*ast.SubrangeSpec); isSubrange {
+		c.typeSpec(sub)
+	} else {
+		c.print(to)
+	}
+	toMin, toMax := c.valueRange(target, to)
+	c.print("(RangeCheck(int64(")
+	c.expr(expr)
+	c.printf("), %d, %d))", toMin, toMax)
+	return true
+}
+
+// needsRangeCheck reports whether range checks are on and the value of
+// expr may not fit in the target type.
+func (c *converter) needsRangeCheck(expr ast.Expr, target ast.TypeSpec) bool {
+	if !c.options.RangeChecks && !c.curSwitches.On('R') {
+		return false
+	}
+	from, to := c.exprType(expr), c.basicType(target)
+	if _, isInt := intRanges[from]; !isInt {
+		return false
+	}
+	if _, isInt := intRanges[to]; !isInt {
+		return false
+	}
+	fromMin, fromMax := c.valueRange(c.typeOf(expr), from)
+	toMin, toMax := c.valueRange(target, to)
+	return fromMin < toMin || fromMax > toMax
+}
+
+// valueRange returns the range of values of a type whose values are of
+// the given Go integer type, which is narrower than the Go type's
+// range for a subrange type.
+func (c *converter) valueRange(spec ast.TypeSpec, goType string) (min, max int64) {
+	if sub, isSubrange := c.info.Resolve(spec).(*ast.SubrangeSpec); isSubrange {
+		if subMin, subMax, ok := c.info.Bounds(sub); ok {
+			offset := int64(c.ordOffset(sub))
+			return int64(subMin) + offset, int64(subMax) + offset
+		}
+	}
+	return intRanges[goType].min, intRanges[goType].max
+}
+
+// ordOffset returns the difference between the Go value and the
+// Pascal ordinal value of an ordinal type: 1 for enumerated types (and
+// subranges of them) as their Go constants start at 1, otherwise 0.
+func (c *converter) ordOffset(spec ast.TypeSpec) int {
+	if _, isEnum := c.info.Underlying(c.info.Resolve(spec)).(*ast.ScalarSpec); isEnum {
+		return 1
+	}
+	return 0
+}
+
+// arrayMin returns the Go value of an array's lowest index, which is
+// subtracted from indexes as Go arrays start at 0.
+func (c *converter) arrayMin(spec *ast.ArraySpec) int {
+	if spec.Index == nil {
+		min, ok := c.info.IntValue(spec.Min)
+		if !ok {
+			panic(fmt.Sprintf("array lower bound not constant: %s", spec.Min))
+		}
+		return min
+	}
+	min, _, ok := c.info.Bounds(spec.Index)
+	if !ok {
+		panic(fmt.Sprintf("array index type has no bounds: %s", spec.Index))
+	}
+	return min + c.ordOffset(spec.Index)
+}
+
+// exprType returns the Go type of the code written for expr (see
+// basicType), or "" for an untyped constant.
+func (c *converter) exprType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.BinaryExpr:
+		if isMathOp(expr.Op) && c.info.Operands[expr] != nil {
+			return c.basicType(c.arithType(expr))
+		}
+	case *ast.ParenExpr:
+		return c.exprType(expr.Expr)
+	case *ast.UnaryExpr:
+		return c.exprType(expr.Expr)
+	}
+	return c.basicType(c.typeOf(expr))
+}
+
+// basicType returns the Go type that values of the given type are
+// worked with as: one of Go's numeric types, "bool", or "string". It
+// returns "" for other types, and for untyped integer constants.
+func (c *converter) basicType(spec ast.TypeSpec) string {
+	switch spec := c.info.Underlying(c.info.Resolve(spec)).(type) {
+	case *ast.FuncSpec:
+		return c.basicType(&ast.IdentSpec{Type: spec.Result})
+	case *ast.ScalarSpec:
+		return "byte"
+	case *ast.StringSpec:
+		return "string"
+	case *ast.IdentSpec:
+		return basicTypes[strings.ToLower(spec.Type.Name)]
+	}
+	return ""
+}
@@ -0,0 +1,315 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// A Pascal goto can jump anywhere in its procedure, for example into
+// the else branch of an "if" statement, but a Go goto can't jump into
+// a block, or forward over a variable declaration. So before a body
+// is converted, the statements that a goto's label is nested in (but
+// the goto isn't) are marked to be "lowered": converted to flat
+// statements with generated labels and gotos instead of a Go "if",
+// "for", or "switch" block (see lowerStmt). And the variable declared
+// for a "with" statement that a goto jumps over is declared in a
+// block of its own.
+
+// gotoBlock is a statement converted to a Go block, and which part of
+// it (the branch of an "if" or the element of a "case") is the block.
+type gotoBlock struct {
+	stmt ast.Stmt
+	part int
+}
+
+// gotoNode is a goto, label, or "with" statement, and the blocks it's
+// nested in, outermost first.
+type gotoNode struct {
+	stmt ast.Stmt
+	path []gotoBlock
+}
+
+// gotoFinder finds the gotos and labels in a body, and the "with"
+// statements whose variable is declared with := (see WithStmt in
+// converter.stmt).
+type gotoFinder struct {
+	labels map[string]gotoNode // keyed by lowercase label
+	gotos  []gotoNode
+	withs  []gotoNode
+}
+
+func (f *gotoFinder) stmts(stmts []ast.Stmt, path []gotoBlock) {
+	for _, stmt := range stmts {
+		f.stmt(stmt, path)
+	}
+}
+
+// body finds the gotos and labels in the body of a statement, which
+// isn't a block of its own if it's a compound statement (see
+// converter.stmtNoBraces).
+func (f *gotoFinder) body(stmt ast.Stmt, path []gotoBlock) {
+	if compound, isCompound := stmt.(*ast.CompoundStmt); isCompound {
+		f.stmts(compound.Stmts, path)
+	} else {
+		f.stmt(stmt, path)
+	}
+}
+
+func (f *gotoFinder) stmt(stmt ast.Stmt, path []gotoBlock) {
+	switch stmt := stmt.(type) {
+	case *ast.CaseStmt:
+		for i, cas := range stmt.Cases {
+			f.body(cas.Stmt, enterBlock(path, stmt, i))
+		}
+		f.stmts(stmt.Else, enterBlock(path, stmt, len(stmt.Cases)))
+	case *ast.CompoundStmt:
+		f.stmts(stmt.Stmts, enterBlock(path, stmt, 0))
+	case *ast.ForStmt:
+		f.body(stmt.Stmt, enterBlock(path, stmt, 0))
+	case *ast.GotoStmt:
+		f.gotos = append(f.gotos, gotoNode{stmt, path})
+	case *ast.IfStmt:
+		f.body(stmt.Then, enterBlock(path, stmt, 0))
+		if stmt.Else != nil {
+			f.body(stmt.Else, enterBlock(path, stmt, 1))
+		}
+	case *ast.LabelledStmt:
+		f.labels[strings.ToLower(stmt.Label)] = gotoNode{stmt, path}
+		f.stmt(stmt.Stmt, path)
+	case *ast.RepeatStmt:
+		f.stmts(stmt.Stmts, enterBlock(path, stmt, 0))
+	case *ast.WhileStmt:
+		f.body(stmt.Stmt, enterBlock(path, stmt, 0))
+	case *ast.WithStmt:
+		if _, isIdent := stmt.Var.(*ast.IdentExpr); !isIdent {
+			f.withs = append(f.withs, gotoNode{stmt, path})
+		}
+		f.body(stmt.Stmt, path)
+	}
+}
+
+// enterBlock returns a copy of path with the given block appended.
+func enterBlock(path []gotoBlock, stmt ast.Stmt, part int) []gotoBlock {
+	return append(path[:len(path):len(path)], gotoBlock{stmt, part})
+}
+
+// resolveGotos finds the statements in the given body that need to be
+// lowered, and the "with" statements that need a block of their own,
+// for the body's gotos to be legal in Go.
+func (c *converter) resolveGotos(body *ast.CompoundStmt) {
+	c.numLabels = 0
+	f := &gotoFinder{labels: make(map[string]gotoNode)}
+	f.stmts(body.Stmts, nil)
+
+	type jump struct{ from, to gotoNode }
+	var jumps []jump
+	for _, from := range f.gotos {
+		label := from.stmt.(*ast.GotoStmt).Label
+		to, ok := f.labels[strings.ToLower(label)]
+		if !ok {
+			panic(fmt.Sprintf("label %s not found", label))
+		}
+		jumps = append(jumps, jump{from, to})
+
+		// Lower the blocks the label is in that the goto isn't in
+		i := 0
+		for i < len(from.path) && i < len(to.path) && from.path[i] == to.path[i] {
+			i++
+		}
+		for _, block := range to.path[i:] {
+			c.lowered[block.stmt] = true
+		}
+	}
+
+	// A forward goto can't jump over a "with" variable declared in a
+	// block the label is in
+	for _, j := range jumps {
+		if !before(j.from.stmt.Pos(), j.to.stmt.Pos()) {
+			continue
+		}
+		for _, with := range f.withs {
+			if before(j.from.stmt.Pos(), with.stmt.Pos()) && before(with.stmt.Pos(), j.to.stmt.Pos()) &&
+				isPrefix(c.goBlocks(with.path), c.goBlocks(j.to.path)) {
+				c.bracedWiths[with.stmt.(*ast.WithStmt)] = true
+			}
+		}
+	}
+	for _, j := range jumps {
+		for _, with := range f.withs {
+			if c.bracedWiths[with.stmt.(*ast.WithStmt)] && within(j.to.stmt, with.stmt) && !within(j.from.stmt, with.stmt) {
+				panic("goto into a 'with' statement not supported")
+			}
+		}
+	}
+}
+
+// goBlocks returns the blocks in path that are still Go blocks after
+// lowering.
+func (c *converter) goBlocks(path []gotoBlock) []gotoBlock {
+	var blocks []gotoBlock
+	for _, block := range path {
+		if !c.lowered[block.stmt] {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func isPrefix(prefix, path []gotoBlock) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, block := range prefix {
+		if path[i] != block {
+			return false
+		}
+	}
+	return true
+}
+
+// before reports whether position a is before position b.
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// within reports whether node is inside outer (or is outer).
+func within(node, outer ast.Node) bool {
+	return !before(node.Pos(), outer.Pos()) && before(node.Pos(), outer.End())
+}
+
+// lowerStmt converts a statement that a goto jumps into (see
+// resolveGotos) using labels and gotos instead of a Go block. The
+// labels are numbered to make them unique in the function.
+func (c *converter) lowerStmt(stmt ast.Stmt) {
+	c.numLabels++
+	n := c.numLabels
+	switch stmt := stmt.(type) {
+	case *ast.CaseStmt:
+		c.print("switch ")
+		c.expr(stmt.Selector)
+		c.print(" {\n")
+		for i, cas := range stmt.Cases {
+			c.print("case ")
+			c.caseConsts(cas.Consts)
+			c.printf(":\ngoto case%d_%d\n", n, i)
+		}
+		if stmt.Else != nil {
+			c.printf("default:\ngoto caseElse%d\n}\n", n)
+		} else {
+			c.printf("default:\ngoto caseEnd%d\n}\n", n)
+		}
+		endUsed := stmt.Else == nil
+		for i, cas := range stmt.Cases {
+			c.printf("case%d_%d:\n", n, i)
+			c.stmtNoBraces(cas.Stmt)
+			c.endComments(cas)
+			if !jumpsAway(cas.Stmt) {
+				c.printf("goto caseEnd%d\n", n)
+				endUsed = true
+			}
+		}
+		if stmt.Else != nil {
+			c.printf("caseElse%d:\n", n)
+			c.stmts(stmt.Else)
+			c.endComments(stmt)
+		}
+		if !endUsed {
+			return
+		}
+		c.printf("caseEnd%d:", n)
+	case *ast.CompoundStmt:
+		c.block(stmt)
+		return
+	case *ast.ForStmt:
+		c.printf("%s = ", stmt.Var.Name)
+		c.assignRhs(stmt.Var, stmt.Initial)
+		c.printf("\nfor%d:\nif ", n)
+		if stmt.Down {
+			c.expr(&ast.BinaryExpr{Left: stmt.Var, Op: token.LESS, Right: stmt.Final})
+		} else {
+			c.expr(&ast.BinaryExpr{Left: stmt.Var, Op: token.GREATER, Right: stmt.Final})
+		}
+		c.printf(" {\ngoto forEnd%d\n}\n", n)
+		c.stmtNoBraces(stmt.Stmt)
+		if stmt.Down {
+			c.printf("%s--\n", stmt.Var.Name)
+		} else {
+			c.printf("%s++\n", stmt.Var.Name)
+		}
+		c.printf("goto for%d\nforEnd%d:", n, n)
+	case *ast.IfStmt:
+		c.print("if ")
+		c.notExpr(stmt.Cond)
+		if stmt.Else != nil {
+			c.printf(" {\ngoto ifElse%d\n}\n", n)
+		} else {
+			c.printf(" {\ngoto ifEnd%d\n}\n", n)
+		}
+		c.stmtNoBraces(stmt.Then)
+		if stmt.Else != nil {
+			if jumpsAway(stmt.Then) {
+				c.printf("ifElse%d:\n", n)
+				c.stmtNoBraces(stmt.Else)
+				return
+			}
+			c.printf("goto ifEnd%d\nifElse%d:\n", n, n)
+			c.stmtNoBraces(stmt.Else)
+		}
+		c.printf("ifEnd%d:", n)
+	case *ast.RepeatStmt:
+		c.printf("repeat%d:\n", n)
+		c.stmts(stmt.Stmts)
+		c.print("if ")
+		c.notExpr(stmt.Cond)
+		c.printf(" {\ngoto repeat%d\n}", n)
+	case *ast.WhileStmt:
+		c.printf("while%d:\nif ", n)
+		c.notExpr(stmt.Cond)
+		c.printf(" {\ngoto whileEnd%d\n}\n", n)
+		c.stmtNoBraces(stmt.Stmt)
+		c.printf("goto while%d\nwhileEnd%d:", n, n)
+	default:
+		panic(fmt.Sprintf("unexpected lowered Stmt: %T", stmt))
+	}
+	c.trailingComments(stmt)
+	c.print("\n")
+}
+
+// jumpsAway reports whether stmt ends with an Exit or goto, so that a
+// goto after it would be unreachable (and its label unused).
+func jumpsAway(stmt ast.Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ast.CompoundStmt:
+		return len(stmt.Stmts) > 0 && jumpsAway(stmt.Stmts[len(stmt.Stmts)-1])
+	case *ast.GotoStmt:
+		return true
+	case *ast.LabelledStmt:
+		return jumpsAway(stmt.Stmt)
+	case *ast.ProcStmt:
+		return strings.ToLower(stmt.Proc.String()) == "exit"
+	}
+	return false
+}
+
+// notExpr prints the negation of a boolean condition.
+func (c *converter) notExpr(cond ast.Expr) {
+	switch cond := cond.(type) {
+	case *ast.BinaryExpr:
+		c.print("!(")
+		c.expr(cond)
+		c.print(")")
+	case *ast.UnaryExpr:
+		if cond.Op == token.NOT && !c.isInteger(cond.Expr) {
+			c.expr(cond.Expr)
+			return
+		}
+		c.print("!")
+		c.expr(cond)
+	default:
+		c.print("!")
+		c.expr(cond)
+	}
+}
@@ -0,0 +1,451 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/check"
+)
+
+// Turbo Pascal 5.5 object types become Go structs, with the parent
+// type embedded, and their methods become Go methods with a "self"
+// receiver. Virtual methods are called through the "vmt" field, an
+// interface value holding a pointer to the whole object, which is
+// added to the first type in the hierarchy with virtual methods and
+// set by the constructors. As the field points to the object itself,
+// it's pointed at the copy whenever an object is copied, by assignment
+// or as a value parameter. A type that adds virtual methods gets its
+// own interface type (TFooVMT) embedding its parent's, and calls to
+// those methods assert the vmt field to it.
+//
+// A constructor of a type with a vmt field becomes two methods: the
+// constructor itself, which sets the field and calls the body method
+// (initBody for Init), and the body, which an inherited constructor
+// call like TParent.Init(...) calls directly so the field isn't reset
+// to the ancestor. Each constructor also gets a Go constructor
+// function (NewTFoo for Init, otherwise NewTFooName), which is what
+// New(p, Init(...)) is converted to.
+
+// objectName returns the name of the given object type.
+func (c *converter) objectName(object *ast.ObjectSpec) string {
+	sym := c.info.Objects[object]
+	if sym == nil {
+		panic("object type must be declared in a type definition")
+	}
+	return sym.Name
+}
+
+// objectOf returns the object type of the given type, or nil if it's
+// not an object type.
+func (c *converter) objectOf(spec ast.TypeSpec) *ast.ObjectSpec {
+	object, _ := c.info.Resolve(spec).(*ast.ObjectSpec)
+	return object
+}
+
+// pointerObject returns the object type the given pointer type points
+// to, or nil if it's not a pointer to an object type.
+func (c *converter) pointerObject(spec ast.TypeSpec) *ast.ObjectSpec {
+	pointer, isPointer := c.info.Resolve(spec).(*ast.PointerSpec)
+	if !isPointer {
+		return nil
+	}
+	return c.objectOf(&ast.IdentSpec{Type: pointer.Type})
+}
+
+// ancestors returns an object type and its ancestors, starting with
+// the topmost ancestor.
+func (c *converter) ancestors(object *ast.ObjectSpec) []*ast.ObjectSpec {
+	var objects []*ast.ObjectSpec
+	for ; object != nil; object = c.info.Parent(object) {
+		objects = append([]*ast.ObjectSpec{object}, objects...)
+	}
+	return objects
+}
+
+// declaringObject returns the object type (object itself or its
+// nearest ancestor) that declares the named method.
+func (c *converter) declaringObject(object *ast.ObjectSpec, name string) *ast.ObjectSpec {
+	for ; object != nil; object = c.info.Parent(object) {
+		if check.OwnMethod(object, name) != nil {
+			return object
+		}
+	}
+	return nil
+}
+
+// introducingObject returns the topmost object type in object's
+// hierarchy that declares the named method virtual, which is the one
+// whose VMT interface includes it.
+func (c *converter) introducingObject(object *ast.ObjectSpec, name string) *ast.ObjectSpec {
+	for _, ancestor := range c.ancestors(object) {
+		if isVirtual(check.OwnMethod(ancestor, name)) {
+			return ancestor
+		}
+	}
+	return nil
+}
+
+// newVirtuals returns the headings of the virtual methods an object
+// type adds (rather than overrides).
+func (c *converter) newVirtuals(object *ast.ObjectSpec) []ast.DeclPart {
+	var methods []ast.DeclPart
+	for _, method := range object.Methods {
+		if isVirtual(method) && c.introducingObject(object, methodName(method)) == object {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// vmtObject returns the object type in object's hierarchy whose
+// struct has the vmt field, or nil if no type in it has virtual
+// methods.
+func (c *converter) vmtObject(object *ast.ObjectSpec) *ast.ObjectSpec {
+	for _, ancestor := range c.ancestors(object) {
+		if len(c.newVirtuals(ancestor)) > 0 {
+			return ancestor
+		}
+	}
+	return nil
+}
+
+// vmtInterface returns the name of the VMT interface type for calls
+// to an object's virtual methods: that of the nearest type in its
+// hierarchy that adds virtual methods.
+func (c *converter) vmtInterface(object *ast.ObjectSpec) string {
+	for ; object != nil; object = c.info.Parent(object) {
+		if len(c.newVirtuals(object)) > 0 {
+			return c.objectName(object) + "VMT"
+		}
+	}
+	return ""
+}
+
+// vmtPath returns what goes between an object and the name of the
+// given method (or field) to call it: "" for a static method, or the
+// vmt field for a virtual one, asserted to the interface type that
+// has the method if it was added after the vmt field's type.
+func (c *converter) vmtPath(object *ast.ObjectSpec, sym *check.Symbol) string {
+	if sym == nil || (sym.Kind != check.SymProc && sym.Kind != check.SymFunc) || !isVirtual(sym.Decl) {
+		return ""
+	}
+	introducer := c.introducingObject(object, sym.Name)
+	if introducer == c.vmtObject(object) {
+		return ".vmt"
+	}
+	return fmt.Sprintf(".vmt.(%sVMT)", c.objectName(introducer))
+}
+
+func isVirtual(method ast.Node) bool {
+	switch method := method.(type) {
+	case *ast.ProcDecl:
+		return method.Virtual
+	case *ast.FuncDecl:
+		return method.Virtual
+	}
+	return false
+}
+
+func methodName(method ast.DeclPart) string {
+	switch method := method.(type) {
+	case *ast.ProcDecl:
+		return method.Name
+	case *ast.FuncDecl:
+		return method.Name
+	}
+	return ""
+}
+
+func isConstructor(method ast.Node) bool {
+	proc, isProc := method.(*ast.ProcDecl)
+	return isProc && proc.Kind == ast.Constructor
+}
+
+// methodBody returns the Go name of the method holding the body of
+// the given method of an object type (see the comment at the top).
+func (c *converter) methodBody(object *ast.ObjectSpec, method ast.DeclPart) string {
+	name := methodName(method)
+	if isConstructor(method) && c.vmtObject(object) != nil {
+		return strings.ToLower(name[:1]) + name[1:] + "Body"
+	}
+	return name
+}
+
+// constructorFunc returns the name of the Go constructor function for
+// the named constructor of an object type.
+func (c *converter) constructorFunc(object *ast.ObjectSpec, name string) string {
+	if strings.EqualFold(name, "Init") {
+		return "New" + c.objectName(object)
+	}
+	return "New" + c.objectName(object) + name
+}
+
+// constructors returns the headings of the constructors of an object
+// type, including inherited ones.
+func (c *converter) constructors(object *ast.ObjectSpec) []*ast.ProcDecl {
+	var ctors []*ast.ProcDecl
+	index := make(map[string]int)
+	for _, ancestor := range c.ancestors(object) {
+		for _, method := range ancestor.Methods {
+			if !isConstructor(method) {
+				continue
+			}
+			ctor := method.(*ast.ProcDecl)
+			key := strings.ToLower(ctor.Name)
+			if i, inherited := index[key]; inherited {
+				ctors[i] = ctor
+				continue
+			}
+			index[key] = len(ctors)
+			ctors = append(ctors, ctor)
+		}
+	}
+	return ctors
+}
+
+// objectStruct writes the Go struct type for an object type.
+func (c *converter) objectStruct(spec *ast.ObjectSpec) {
+	c.print("struct {\n")
+	if parent := c.info.Parent(spec); parent != nil {
+		c.print(c.objectName(parent), "\n")
+	}
+	if c.vmtObject(spec) == spec {
+		c.printf("vmt %sVMT\n", c.objectName(spec))
+	}
+	c.fieldSections(spec.Sections)
+	c.print("}")
+}
+
+// objectMethods writes the VMT interface, constructors, and
+// constructor functions of the named object type. Its other methods
+// are written where they're implemented.
+func (c *converter) objectMethods(typeName string, spec *ast.ObjectSpec) {
+	if virtuals := c.newVirtuals(spec); len(virtuals) > 0 {
+		c.printf("type %sVMT interface {\n", typeName)
+		if parent := c.info.Parent(spec); parent != nil && c.vmtObject(parent) != nil {
+			c.print(c.vmtInterface(parent), "\n")
+		}
+		for _, method := range virtuals {
+			c.print(methodName(method), "(")
+			switch method := method.(type) {
+			case *ast.ProcDecl:
+				c.params(method.Params)
+				c.print(")")
+			case *ast.FuncDecl:
+				c.params(method.Params)
+				c.print(") ")
+				c.typeIdent(method.Result)
+			}
+			c.print("\n")
+		}
+		c.print("}\n\n")
+	}
+
+	for _, ctor := range c.constructors(spec) {
+		args := paramNames(ctor.Params)
+		if c.vmtObject(spec) != nil {
+			c.printf("func (self *%s) %s(", typeName, ctor.Name)
+			c.params(ctor.Params)
+			c.print(") {\nself.vmt = self\nself.")
+			declaring := c.declaringObject(spec, ctor.Name)
+			if declaring != spec {
+				c.print(c.objectName(declaring), ".")
+			}
+			c.printf("%s(%s)\n}\n\n", c.methodBody(declaring, ctor), args)
+		}
+
+		c.printf("func %s(", c.constructorFunc(spec, ctor.Name))
+		c.params(ctor.Params)
+		c.printf(") *%s {\nself := new(%s)\nself.%s(%s)\nreturn self\n}\n\n",
+			typeName, typeName, ctor.Name, args)
+	}
+}
+
+// hasVMT reports whether spec is an object type with a vmt field.
+func (c *converter) hasVMT(spec ast.TypeSpec) bool {
+	object := c.objectOf(spec)
+	return object != nil && c.vmtObject(object) != nil
+}
+
+// rebindVMT writes a statement that points the vmt field of an object
+// just assigned to expr at expr, as virtual calls on the copy would
+// otherwise call the methods of the original.
+func (c *converter) rebindVMT(expr ast.Expr) {
+	if !c.hasVMT(c.typeOf(expr)) {
+		return
+	}
+	c.print("\n")
+	c.varExpr(expr, true)
+	c.print(".vmt = ")
+	if ident, isIdent := expr.(*ast.IdentExpr); !isIdent || !c.isVarParam(ident) {
+		c.print("&")
+	}
+	c.varExpr(expr, true)
+}
+
+// rebindParamVMTs writes statements that point the vmt fields of a
+// routine's object value parameters, which are copies, at the copies.
+func (c *converter) rebindParamVMTs(params []*ast.ParamGroup) {
+	for _, group := range params {
+		if group.IsVar || !c.hasVMT(&ast.IdentSpec{Type: group.Type}) {
+			continue
+		}
+		for _, name := range group.Names {
+			c.printf("%s.vmt = &%s\n", name, name)
+		}
+	}
+}
+
+func paramNames(params []*ast.ParamGroup) string {
+	var names []string
+	for _, group := range params {
+		names = append(names, group.Names...)
+	}
+	return strings.Join(names, ", ")
+}
+
+// methodStart writes the start of the Go method for the given method
+// implementation, up to its opening parenthesis, and makes it the
+// method being converted.
+func (c *converter) methodStart(decl ast.DeclPart, objType *ast.TypeIdent) {
+	object := c.objectOf(&ast.IdentSpec{Type: objType})
+	if object == nil {
+		panic(fmt.Sprintf("method of unknown object type %s", objType.Name))
+	}
+	heading := check.OwnMethod(object, methodName(decl))
+	if heading == nil {
+		panic(fmt.Sprintf("object type %s has no method %s", objType.Name, methodName(decl)))
+	}
+	c.method = decl
+	c.self = object
+	c.printf("func (self *%s) %s(", c.objectName(object), c.methodBody(object, heading))
+}
+
+// methodEnd leaves the method being converted, after its scope has
+// been exited.
+func (c *converter) methodEnd() {
+	c.scope = c.scope.Parent // object scope
+	c.method = nil
+	c.self = nil
+}
+
+// memberPrefix writes what goes before the name of a field or method
+// of the object being converted, used by name in a method body.
+func (c *converter) memberPrefix(sym *check.Symbol) {
+	c.print("self", c.vmtPath(sym.Scope.Node.(*ast.ObjectSpec), sym), ".")
+}
+
+// isInheritedCall reports whether expr is a call to an ancestor's (or
+// the object's own) method qualified by the type name, like
+// TParent.Init, which is a static call even if the method is virtual.
+func (c *converter) isInheritedCall(expr *ast.DotExpr) bool {
+	ident, isIdent := expr.Record.(*ast.IdentExpr)
+	if !isIdent {
+		return false
+	}
+	sym := c.info.Uses[ident]
+	return sym != nil && sym.Kind == check.SymType
+}
+
+// inheritedCall writes the method of an inherited call like
+// TParent.Init (without the arguments).
+func (c *converter) inheritedCall(expr *ast.DotExpr) {
+	if c.self == nil {
+		panic(fmt.Sprintf("%s called outside a method", expr))
+	}
+	object := c.objectOf(c.typeOf(expr.Record))
+	declaring := c.declaringObject(object, expr.Field)
+	if declaring == nil {
+		panic(fmt.Sprintf("unknown method %s", expr))
+	}
+	c.print("self.")
+	if declaring != c.self {
+		c.print(c.objectName(declaring), ".")
+	}
+	c.print(c.methodBody(declaring, check.OwnMethod(declaring, expr.Field)))
+}
+
+// upcast writes a pointer to an object (or an object passed as a var
+// parameter) as a pointer to its ancestor part if the target type is
+// an ancestor's, as a Go struct doesn't convert to the types embedded
+// in it. It returns false if no conversion is needed and nothing was
+// written.
+func (c *converter) upcast(target ast.TypeSpec, isVar bool, expr ast.Expr) bool {
+	var to, from *ast.ObjectSpec
+	if isVar {
+		to = c.objectOf(target)
+		from = c.objectOf(c.typeOf(expr))
+	} else {
+		to = c.pointerObject(target)
+		if atExpr, isAt := expr.(*ast.AtExpr); isAt {
+			expr = atExpr.Expr
+			from = c.objectOf(c.typeOf(expr))
+		} else {
+			from = c.pointerObject(c.typeOf(expr))
+		}
+	}
+	if to == nil || from == nil || to == from {
+		return false
+	}
+	for ancestor := c.info.Parent(from); ancestor != to; ancestor = c.info.Parent(ancestor) {
+		if ancestor == nil {
+			return false
+		}
+	}
+	c.print("&")
+	c.varExpr(expr, true)
+	c.printf(".%s", c.objectName(to))
+	return true
+}
+
+// objectAlloc writes a call to New or Dispose with a constructor or
+// destructor call as the second argument: New(p, Init(...)) as a call
+// to the constructor function, and Dispose(p, Done) as a call to the
+// destructor before the Dispose. If isStmt is false, it's a New
+// function call like New(PFoo, Init(...)). It returns false if it's
+// not such a call and nothing was written.
+func (c *converter) objectAlloc(proc ast.Expr, args []ast.Expr, isStmt bool) bool {
+	ident, isIdent := proc.(*ast.IdentExpr)
+	if !isIdent || len(args) != 2 {
+		return false
+	}
+	procStr := strings.ToLower(ident.Name)
+	if procStr != "new" && procStr != "dispose" {
+		return false
+	}
+	object := c.pointerObject(c.typeOf(args[0]))
+	if object == nil {
+		panic(fmt.Sprintf("%s requires a pointer to an object: %s", ident.Name, args[0]))
+	}
+	method, methodArgs := args[1], []ast.Expr(nil)
+	if funcExpr, isFunc := method.(*ast.FuncExpr); isFunc {
+		method, methodArgs = funcExpr.Func, funcExpr.Args
+	}
+	methodIdent := method.(*ast.IdentExpr)
+	sym := c.info.Uses[methodIdent]
+	if sym == nil {
+		panic(fmt.Sprintf("unknown method: %s", method))
+	}
+	var params []*ast.ParamGroup
+	if spec, isProc := sym.Type.(*ast.ProcSpec); isProc {
+		params = spec.Params
+	}
+	if procStr == "new" {
+		if isStmt {
+			c.varExpr(args[0], false)
+			c.print(" = ")
+		}
+		c.printf("%s(", c.constructorFunc(object, sym.Name))
+		c.procArgs(params, methodArgs)
+		c.print(")")
+		return true
+	}
+	c.varExpr(args[0], true)
+	c.printf("%s.%s(", c.vmtPath(object, sym), methodIdent.Name)
+	c.procArgs(params, methodArgs)
+	c.print(")\nDispose(")
+	c.expr(args[0])
+	c.print(")")
+	return true
+}
@@ -0,0 +1,487 @@
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/check"
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// The fields of a record's variant part share memory, and Turbo
+// Pascal code relies on that to overlay data, for example writing a
+// Longint and reading it back as bytes. So these fields are stored in
+// a byte array (the "variant" field of the Go struct) in the same
+// little-endian layout as in DOS, and read and written with accessor
+// methods generated for each field: r.Name() and r.SetName(v), or
+// r.Name(i) and r.SetName(i, v) for array fields. Fields of types
+// that can't be stored as bytes in Go, such as pointers, are accessed
+// as raw []byte slices of the backing array instead. Typed constants
+// can't set variant fields in a Go composite literal, so they're set
+// with the accessor methods in an init function.
+
+// variantLayout is where the fields of a record's variant part are
+// stored in its backing array.
+type variantLayout struct {
+	Fields []*variantField          // in declaration order
+	ByName map[string]*variantField // keyed by lowercase name
+	Size   int                      // size of the backing array
+}
+
+type variantField struct {
+	Name   string // as declared
+	Type   ast.TypeSpec
+	Offset int            // offset of the field in the backing array
+	Pos    token.Position // position of the field's declaration
+}
+
+// variantLayout returns the layout of the variant part of the given
+// record type.
+func (c *converter) variantLayout(spec *ast.RecordSpec) *variantLayout {
+	layout := c.variantLayouts[spec]
+	if layout == nil {
+		layout = &variantLayout{ByName: make(map[string]*variantField)}
+		layout.Size = c.layoutVariant(layout, spec.Variant, 0)
+		c.variantLayouts[spec] = layout
+	}
+	return layout
+}
+
+// layoutVariant adds the fields of a variant part starting at offset
+// to layout, and returns the size of the variant part, which is the
+// size of its largest case as the cases overlay each other.
+func (c *converter) layoutVariant(layout *variantLayout, variant *ast.RecordVariant, offset int) int {
+	size := 0
+	add := func(name string, typ ast.TypeSpec, offset int, pos token.Position) {
+		field := &variantField{Name: name, Type: typ, Offset: offset, Pos: pos}
+		layout.Fields = append(layout.Fields, field)
+		layout.ByName[strings.ToLower(name)] = field
+	}
+	for _, cas := range variant.Cases {
+		caseOffset := offset
+		for _, section := range cas.Sections {
+			for _, name := range section.Names {
+				add(name, section.Type, caseOffset, section.Pos())
+				caseOffset += c.sizeOf(section.Type)
+			}
+		}
+		if cas.Variant != nil {
+			// Unlike the outer tag, the tag of a nested variant part
+			// is stored in the backing array too
+			if cas.Variant.Tag != "" {
+				tagType := &ast.IdentSpec{Type: cas.Variant.Type}
+				add(cas.Variant.Tag, tagType, caseOffset, cas.Variant.Pos())
+				caseOffset += c.sizeOf(tagType)
+			}
+			caseOffset += c.layoutVariant(layout, cas.Variant, caseOffset)
+		}
+		if caseOffset-offset > size {
+			size = caseOffset - offset
+		}
+	}
+	return size
+}
+
+// sizeOf returns the size in bytes of a value of the given type in
+// Turbo Pascal's memory layout.
+func (c *converter) sizeOf(spec ast.TypeSpec) int {
+	switch spec := c.info.Resolve(spec).(type) {
+	case *ast.ScalarSpec:
+		return 1
+	case *ast.SubrangeSpec:
+		return c.sizeOf(c.info.Underlying(spec))
+	case *ast.StringSpec:
+		return spec.Size + 1
+	case *ast.ArraySpec:
+		return c.arrayLen(spec) * c.sizeOf(spec.Of)
+	case *ast.PointerSpec:
+		return 4
+	case *ast.SetSpec:
+		// A set only stores the bytes its element type's range spans
+		min, max, ok := c.info.Bounds(spec.Of)
+		if !ok {
+			panic(fmt.Sprintf("set element type has no bounds: %s", spec.Of))
+		}
+		return max/8 - min/8 + 1
+	case *ast.RecordSpec:
+		size := 0
+		for _, section := range spec.Sections {
+			size += len(section.Names) * c.sizeOf(section.Type)
+		}
+		if spec.Variant != nil {
+			if spec.Variant.Tag != "" {
+				size += c.sizeOf(&ast.IdentSpec{Type: spec.Variant.Type})
+			}
+			size += c.variantLayout(spec).Size
+		}
+		return size
+	case *ast.IdentSpec:
+		switch strings.ToLower(spec.Type.Name) {
+		case "boolean", "byte", "char", "shortint":
+			return 1
+		case "integer", "word":
+			return 2
+		case "longint", "pointer", "single":
+			return 4
+		case "real":
+			return 6
+		case "comp", "double":
+			return 8
+		case "extended":
+			return 10
+		case "string":
+			return 256
+		}
+	}
+	panic(fmt.Sprintf("size of type not known: %s", spec))
+}
+
+// arrayLen returns the number of elements in an array type.
+func (c *converter) arrayLen(spec *ast.ArraySpec) int {
+	if spec.Index != nil {
+		min, max, ok := c.info.Bounds(spec.Index)
+		if !ok {
+			panic(fmt.Sprintf("array index type has no bounds: %s", spec.Index))
+		}
+		return max - min + 1
+	}
+	min, minOK := c.info.IntValue(spec.Min)
+	max, maxOK := c.info.IntValue(spec.Max)
+	if !minOK || !maxOK {
+		panic(fmt.Sprintf("array size not known: %s", spec))
+	}
+	return max - min + 1
+}
+
+// variantField returns the field of a record's variant part that expr
+// (a field selection, or a field name inside a "with") refers to, or
+// nil if it's not one.
+func (c *converter) variantField(expr ast.Expr) *variantField {
+	var record ast.TypeSpec
+	var name string
+	switch expr := expr.(type) {
+	case *ast.DotExpr:
+		record, name = c.typeOf(expr.Record), expr.Field
+	case *ast.IdentExpr:
+		sym := c.info.Uses[expr]
+		if sym == nil || sym.Kind != check.SymField || sym.Scope == nil || sym.Scope.Kind != check.ScopeWith {
+			return nil
+		}
+		record, name = c.typeOf(sym.Scope.Node.(*ast.WithStmt).Var), expr.Name
+	default:
+		return nil
+	}
+	spec, isRecord := record.(*ast.RecordSpec)
+	if !isRecord || spec.Variant == nil {
+		return nil
+	}
+	return c.variantLayout(spec).ByName[strings.ToLower(name)]
+}
+
+// variantArray returns the array type of a variant field, or nil if
+// it's not an array.
+func (c *converter) variantArray(field *variantField) *ast.ArraySpec {
+	array, _ := c.info.Resolve(field.Type).(*ast.ArraySpec)
+	return array
+}
+
+// variantRead writes a read of a variant field, or an element of a
+// variant array field, as a call to its accessor method.
+func (c *converter) variantRead(expr ast.Expr, field *variantField, index ast.Expr) {
+	c.variantRecv(expr)
+	c.printf("%s(", field.Name)
+	c.variantIndex(field, index)
+	c.print(")")
+}
+
+// variantAssign writes the assignment of value to target if target is
+// a variant field (or an element of a variant array field) as a call
+// to its Set method, and reports whether it was one.
+func (c *converter) variantAssign(target ast.Expr, value func()) bool {
+	var index ast.Expr
+	field := c.variantField(target)
+	if indexExpr, isIndex := target.(*ast.IndexExpr); isIndex && field == nil {
+		field = c.variantField(indexExpr.Array)
+		target, index = indexExpr.Array, indexExpr.Index
+	}
+	if field == nil {
+		return false
+	}
+	c.variantRecv(target)
+	c.printf("Set%s(", field.Name)
+	c.variantIndex(field, index)
+	if index != nil {
+		c.print(", ")
+	}
+	value()
+	c.print(")")
+	return true
+}
+
+// variantRecv writes the record expression (and a ".") that a variant
+// field's accessor method is called on.
+func (c *converter) variantRecv(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.DotExpr:
+		c.varExpr(expr.Record, true)
+	case *ast.IdentExpr:
+		c.print(c.withNames[c.info.Uses[expr].Scope.Node.(*ast.WithStmt)])
+	}
+	c.print(".")
+}
+
+// variantIndex writes the index argument of a variant array field's
+// accessor method, checking that array fields are always indexed.
+func (c *converter) variantIndex(field *variantField, index ast.Expr) {
+	isArray := c.variantArray(field) != nil
+	switch {
+	case index == nil && isArray:
+		panic(fmt.Sprintf("variant array field %s must be indexed", field.Name))
+	case index != nil && !isArray:
+		panic(fmt.Sprintf("indexing variant field %s not supported", field.Name))
+	case index == nil:
+		return
+	}
+	if _, isConst := index.(*ast.ConstExpr); isConst {
+		c.expr(index)
+		return
+	}
+	c.typeConversion(index, "int")
+}
+
+// variantMethods writes the accessor methods for the fields of the
+// variant part of the named record type.
+func (c *converter) variantMethods(typeName string, spec *ast.RecordSpec) {
+	for _, field := range c.variantLayout(spec).Fields {
+		typ := field.Type
+		param, offset := "", fmt.Sprint(field.Offset)
+		if array := c.variantArray(field); array != nil {
+			typ = array.Of
+			param = "i int"
+			elemSize := c.sizeOf(array.Of)
+			offset = "i"
+			if elemSize != 1 {
+				offset = fmt.Sprintf("i*%d", elemSize)
+			}
+			switch base := field.Offset - c.arrayMin(array)*elemSize; {
+			case base > 0:
+				offset += fmt.Sprintf("+%d", base)
+			case base < 0:
+				offset += fmt.Sprintf("%d", base)
+			}
+		}
+
+		load, store := c.variantLoad(typ, offset), c.variantStore(typ, offset)
+		if load == "" {
+			c.variantBytes(typeName, field, typ, param, offset)
+			continue
+		}
+
+		c.printf("func (r *%s) %s(%s) ", typeName, field.Name, param)
+		c.typeSpec(typ)
+		c.printf(" {\nreturn %s\n}\n\n", load)
+
+		if param != "" {
+			param += ", "
+		}
+		c.printf("func (r *%s) Set%s(%sv ", typeName, field.Name, param)
+		c.typeSpec(typ)
+		c.printf(") {\n%s\n}\n\n", store)
+	}
+}
+
+// variantBytes writes the accessor methods for a variant field (or an
+// element of a variant array field) of a type that variantLoad and
+// variantStore don't support, which access its bytes in the backing
+// array directly, and records an error as uses of the field need
+// converting by hand.
+func (c *converter) variantBytes(typeName string, field *variantField, typ ast.TypeSpec, param, offset string) {
+	c.errorf(field.Pos, "variant field %s of type %s can't be converted, so it's accessed as bytes", field.Name, field.Type)
+	end := offsetPlus(offset, c.sizeOf(typ))
+	c.printf("// %s is of type %s, so it's accessed as bytes\n", field.Name, field.Type)
+	c.printf("func (r *%s) %s(%s) []byte {\nreturn r.variant[%s:%s]\n}\n\n", typeName, field.Name, param, offset, end)
+	if param != "" {
+		param += ", "
+	}
+	c.printf("func (r *%s) Set%s(%sv []byte) {\ncopy(r.variant[%s:%s], v)\n}\n\n", typeName, field.Name, param, offset, end)
+}
+
+// variantLoad returns an expression that loads a value of the given
+// type from the backing array at offset, or "" if the type isn't
+// supported.
+func (c *converter) variantLoad(spec ast.TypeSpec, offset string) string {
+	spec = c.info.Underlying(c.info.Resolve(spec))
+	switch spec := spec.(type) {
+	case *ast.ScalarSpec:
+		// Go constants for enumerated values start at 1
+		return fmt.Sprintf("%s(r.variant[%s] + 1)", c.enumType(spec), offset)
+	case *ast.StringSpec:
+		return fmt.Sprintf("LoadString(r.variant[%s:%s])", offset, offsetPlus(offset, spec.Size+1))
+	case *ast.IdentSpec:
+		switch strings.ToLower(spec.Type.Name) {
+		case "byte", "char":
+			return fmt.Sprintf("r.variant[%s]", offset)
+		case "shortint":
+			return fmt.Sprintf("int8(r.variant[%s])", offset)
+		case "boolean":
+			return fmt.Sprintf("r.variant[%s] != 0", offset)
+		case "integer":
+			return fmt.Sprintf("int16(LoadUint16(r.variant[%s:]))", offset)
+		case "word":
+			return fmt.Sprintf("LoadUint16(r.variant[%s:])", offset)
+		case "longint":
+			return fmt.Sprintf("int32(LoadUint32(r.variant[%s:]))", offset)
+		case "comp":
+			return fmt.Sprintf("int64(LoadUint64(r.variant[%s:]))", offset)
+		case "single":
+			return fmt.Sprintf("LoadSingle(r.variant[%s:])", offset)
+		case "double":
+			return fmt.Sprintf("LoadDouble(r.variant[%s:])", offset)
+		case "real":
+			return fmt.Sprintf("LoadReal(r.variant[%s:])", offset)
+		case "string":
+			return fmt.Sprintf("LoadString(r.variant[%s:%s])", offset, offsetPlus(offset, 256))
+		}
+	}
+	return ""
+}
+
+// variantStore returns a statement that stores v (of the given type)
+// in the backing array at offset, or "" if the type isn't supported.
+func (c *converter) variantStore(spec ast.TypeSpec, offset string) string {
+	spec = c.info.Underlying(c.info.Resolve(spec))
+	switch spec := spec.(type) {
+	case *ast.ScalarSpec:
+		return fmt.Sprintf("r.variant[%s] = byte(v - 1)", offset)
+	case *ast.StringSpec:
+		return fmt.Sprintf("StoreString(r.variant[%s:%s], v)", offset, offsetPlus(offset, spec.Size+1))
+	case *ast.IdentSpec:
+		switch strings.ToLower(spec.Type.Name) {
+		case "byte", "char":
+			return fmt.Sprintf("r.variant[%s] = v", offset)
+		case "shortint":
+			return fmt.Sprintf("r.variant[%s] = byte(v)", offset)
+		case "boolean":
+			return fmt.Sprintf("r.variant[%s] = byte(BoolToInt(v))", offset)
+		case "integer":
+			return fmt.Sprintf("StoreUint16(r.variant[%s:], uint16(v))", offset)
+		case "word":
+			return fmt.Sprintf("StoreUint16(r.variant[%s:], v)", offset)
+		case "longint":
+			return fmt.Sprintf("StoreUint32(r.variant[%s:], uint32(v))", offset)
+		case "comp":
+			return fmt.Sprintf("StoreUint64(r.variant[%s:], uint64(v))", offset)
+		case "single":
+			return fmt.Sprintf("StoreSingle(r.variant[%s:], v)", offset)
+		case "double":
+			return fmt.Sprintf("StoreDouble(r.variant[%s:], v)", offset)
+		case "real":
+			return fmt.Sprintf("StoreReal(r.variant[%s:], v)", offset)
+		case "string":
+			return fmt.Sprintf("StoreString(r.variant[%s:%s], v)", offset, offsetPlus(offset, 256))
+		}
+	}
+	return ""
+}
+
+// offsetPlus returns the expression offset+n, adding them up if offset
+// is a constant.
+func offsetPlus(offset string, n int) string {
+	if value, err := strconv.Atoi(offset); err == nil {
+		return strconv.Itoa(value + n)
+	}
+	return fmt.Sprintf("%s+%d", offset, n)
+}
+
+// enumType returns the Go type name of an enumerated type.
+func (c *converter) enumType(spec *ast.ScalarSpec) string {
+	if name := c.enumNames[spec]; name != "" {
+		return name
+	}
+	return "uint8"
+}
+
+// variantConstInit writes the statements that set the variant fields
+// of the given typed constants, in an init function if they're
+// declared at the top level.
+func (c *converter) variantConstInit(decls []*ast.ConstDecl, isMain bool) {
+	found := false
+	for _, d := range decls {
+		c.variantConsts(d.Name, d.Value, func(string, *variantField, ast.Expr, ast.Expr) {
+			found = true
+		})
+	}
+	if !found {
+		return
+	}
+	if isMain {
+		c.print("\nfunc init() {\n")
+	}
+	for _, d := range decls {
+		c.variantConsts(d.Name, d.Value, func(path string, field *variantField, index, value ast.Expr) {
+			c.printf("%s.Set%s(", path, field.Name)
+			typ := field.Type
+			if array := c.variantArray(field); array != nil {
+				c.expr(index)
+				c.print(", ")
+				typ = array.Of
+			}
+			c.convertValue(value, c.basicType(typ))
+			c.print(")\n")
+		})
+	}
+	if isMain {
+		c.print("}\n")
+	}
+}
+
+// variantConsts calls set for each variant field in the typed constant
+// value (written as path in Go), and for each element of a variant
+// array field (with index, the Pascal index of the element). Fields of
+// types accessed as bytes can only be given zero values, which needn't
+// be set.
+func (c *converter) variantConsts(path string, value ast.Expr, set func(path string, field *variantField, index, value ast.Expr)) {
+	switch value := value.(type) {
+	case *ast.ConstArrayExpr:
+		for i, elem := range value.Values {
+			c.variantConsts(fmt.Sprintf("%s[%d]", path, i), elem, set)
+		}
+	case *ast.ConstRecordExpr:
+		record, _ := c.typeOf(value).(*ast.RecordSpec)
+		for _, cf := range value.Fields {
+			var field *variantField
+			if record != nil && record.Variant != nil {
+				field = c.variantLayout(record).ByName[strings.ToLower(cf.Name)]
+			}
+			if field == nil {
+				c.variantConsts(path+"."+cf.Name, cf.Value, set)
+				continue
+			}
+			typ := field.Type
+			array := c.variantArray(field)
+			if array != nil {
+				typ = array.Of
+			}
+			if c.variantLoad(typ, "0") == "" {
+				if cnst, isConst := cf.Value.(*ast.ConstExpr); isConst && cnst.Value == nil {
+					continue // nil pointer
+				}
+				panic(fmt.Sprintf("typed constant can't set variant field %s of type %s", field.Name, field.Type))
+			}
+			if array == nil {
+				set(path, field, nil, cf.Value)
+				continue
+			}
+			elems, isArray := cf.Value.(*ast.ConstArrayExpr)
+			if !isArray {
+				panic(fmt.Sprintf("array constant expected for variant field %s", field.Name))
+			}
+			for i, elem := range elems.Values {
+				index := &ast.ConstExpr{Value: c.arrayMin(array) + i}
+				set(path, field, index, elem)
+			}
+		}
+	}
+}
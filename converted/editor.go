@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: Editor
 
 // interface uses: GameVars, TxtWind
@@ -88,9 +110,11 @@ func EditorLoop() {
 		VideoWriteText(64, 18, 0x1F, " Pattern")
 		VideoWriteText(61, 19, 0x30, " C ")
 		VideoWriteText(64, 19, 0x1F, " Color:")
+		// Colors
 		for i = 9; i <= 15; i++ {
 			VideoWriteText(61+i, 22, byte(i), "\xdb")
 		}
+		// Patterns
 		for i = 1; i <= EditorPatternCount; i++ {
 			VideoWriteText(61+i, 22, 0x0F, string([]byte{ElementDefs[EditorPatterns[i-1]].Character}))
 		}
@@ -310,13 +334,13 @@ func EditorLoop() {
 		}
 		EditorOpenEditTextWindow(&state)
 		for iLine = 1; iLine <= state.LineCount; iLine++ {
-			stat.DataLen += Length(*state.Lines[iLine-1]) + 1
+			stat.DataLen = stat.DataLen + Length(*state.Lines[iLine-1]) + 1
 		}
 		GetMem(stat.Data, stat.DataLen)
 		dataPtr = stat.Data
 		for iLine = 1; iLine <= state.LineCount; iLine++ {
 			for iChar = 1; iChar <= Length(*state.Lines[iLine-1]); iChar++ {
-				dataChar = byte(*state.Lines[iLine-1][iChar-1])
+				dataChar = *state.Lines[iLine-1][iChar-1]
 				Move(dataChar, *dataPtr, 1)
 				AdvancePointer(&dataPtr, 1)
 			}
@@ -721,7 +745,7 @@ func EditorLoop() {
 			case KEY_F3:
 				selectedCategory = CATEGORY_TERRAIN
 			}
-			i = 3
+			i = 3 // Y position for text writing
 			for iElem = 0; iElem <= MAX_ELEMENT; iElem++ {
 				if ElementDefs[iElem].EditorCategory == selectedCategory {
 					if Length(ElementDefs[iElem].CategoryName) != 0 {
@@ -729,7 +753,7 @@ func EditorLoop() {
 						VideoWriteText(65, i, 0x1E, ElementDefs[iElem].CategoryName)
 						i++
 					}
-					VideoWriteText(61, i, byte(i%2<<6+0x30), " "+ElementDefs[iElem].EditorShortcut+' ')
+					VideoWriteText(61, i, byte(i%2<<6+0x30), " "+string([]byte{ElementDefs[iElem].EditorShortcut})+" ")
 					VideoWriteText(65, i, 0x1F, ElementDefs[iElem].Name)
 					if ElementDefs[iElem].Color == COLOR_CHOICE_ON_BLACK {
 						elemMenuColor = cursorColor%0x10 + 0x10
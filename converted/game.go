@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: Game
 
 // interface uses: GameVars, TxtWind
@@ -13,13 +35,15 @@ var (
 	ProgressAnimColors  [8]byte   = [8]byte{0x14, 0x1C, 0x15, 0x1D, 0x16, 0x1E, 0x17, 0x1F}
 	ProgressAnimStrings [8]string = [8]string{"....|", "...*/", "..*.-", ".*..\\", "*...|", "..../", "....-", "....\\"}
 	ColorNames          [7]string = [7]string{"Blue", "Green", "Cyan", "Red", "Purple", "Yellow", "White"}
-	DiagonalDeltaX      [8]int16  = [8]int16{-1, 0, 1, 1, 1, 0, -1, -1}
-	DiagonalDeltaY      [8]int16  = [8]int16{1, 1, 1, 0, -1, -1, -1, 0}
-	NeighborDeltaX      [4]int16  = [4]int16{0, 0, -1, 1}
-	NeighborDeltaY      [4]int16  = [4]int16{-1, 1, 0, 0}
-	TileBorder          TTile     = TTile{Element: E_NORMAL, Color: 0x0E}
-	TileBoardEdge       TTile     = TTile{Element: E_BOARD_EDGE, Color: 0x00}
-	StatTemplateDefault TStat     = TStat{X: 0, Y: 0, StepX: 0, StepY: 0, Cycle: 0, P1: 0, P2: 0, P3: 0, Follower: -1, Leader: -1}
+
+	DiagonalDeltaX [8]int16 = [8]int16{-1, 0, 1, 1, 1, 0, -1, -1}
+	DiagonalDeltaY [8]int16 = [8]int16{1, 1, 1, 0, -1, -1, -1, 0}
+	NeighborDeltaX [4]int16 = [4]int16{0, 0, -1, 1}
+	NeighborDeltaY [4]int16 = [4]int16{-1, 1, 0, 0}
+
+	TileBorder          TTile = TTile{Element: E_NORMAL, Color: 0x0E}
+	TileBoardEdge       TTile = TTile{Element: E_BOARD_EDGE, Color: 0x00}
+	StatTemplateDefault TStat = TStat{X: 0, Y: 0, StepX: 0, StepY: 0, Cycle: 0, P1: 0, P2: 0, P3: 0, Follower: -1, Leader: -1}
 )
 
 // implementation uses: Dos, Crt, Video, Sounds, Input, Elements, Editor, Oop
@@ -48,6 +72,7 @@ func GenerateTransitionTable() {
 			TransitionTable[TransitionTableSize-1].Y = iy
 		}
 	}
+	// shuffle
 	for ix = 1; ix <= TransitionTableSize; ix++ {
 		iy = Random(TransitionTableSize) + 1
 		t = TransitionTable[iy-1]
@@ -272,17 +297,19 @@ func BoardDrawTile(x, y int16) {
 		} else if tile.Element < E_TEXT_MIN {
 			VideoWriteText(x-1, y-1, tile.Color, string([]byte{ElementDefs[tile.Element].Character}))
 		} else {
+			// Text drawing
 			if tile.Element == E_TEXT_WHITE {
 				VideoWriteText(x-1, y-1, 0x0F, Chr(Board.Tiles[x][y].Color))
 			} else if VideoMonochrome {
-				VideoWriteText(x-1, y-1, byte((int16(tile.Element-E_TEXT_MIN)+1)*16), Chr(Board.Tiles[x][y].Color))
+				VideoWriteText(x-1, y-1, byte((int16(tile.Element)-E_TEXT_MIN+1)*16), Chr(Board.Tiles[x][y].Color))
 			} else {
-				VideoWriteText(x-1, y-1, byte((int16(tile.Element-E_TEXT_MIN)+1)*16+0x0F), Chr(Board.Tiles[x][y].Color))
+				VideoWriteText(x-1, y-1, byte((int16(tile.Element)-E_TEXT_MIN+1)*16+0x0F), Chr(Board.Tiles[x][y].Color))
 			}
 
 		}
 
 	} else {
+		// Darkness
 		VideoWriteText(x-1, y-1, 0x07, "\xb0")
 	}
 }
@@ -355,7 +382,7 @@ func SidebarPromptSlider(editable bool, x, y int16, prompt string, value *byte)
 	VideoWriteText(x, y, byte(BoolToInt(editable)+0x1E), prompt)
 	SidebarClearLine(y + 1)
 	SidebarClearLine(y + 2)
-	VideoWriteText(x, y+2, 0x1E, startChar+"....:...."+endChar)
+	VideoWriteText(x, y+2, 0x1E, string([]byte{startChar})+"....:...."+string([]byte{endChar}))
 	for {
 		if editable {
 			if InputJoystickMoved {
@@ -850,6 +877,7 @@ func BoardPrepareTileForPlacement(x, y int16) (BoardPrepareTileForPlacement bool
 		}
 		result = true
 	} else {
+		// statId = 0 (player) cannot be modified
 		result = false
 	}
 
@@ -1025,6 +1053,7 @@ func DamageStat(attackerStatId int16) {
 				World.Info.BoardTimeSec = 0
 				if Board.Info.ReenterWhenZapped {
 					SoundQueue(4, " \x01#\x01'\x010\x01\x10\x01")
+					// Move player to start
 					Board.Tiles[stat.X][stat.Y].Element = E_EMPTY
 					BoardDrawTile(int16(stat.X), int16(stat.Y))
 					oldX = int16(stat.X)
@@ -1184,7 +1213,7 @@ func GameDebugPrompt() {
 	SidebarClearLine(5)
 	PromptString(63, 5, 0x1E, 0x0F, 11, PROMPT_ANY, &input)
 	for i = 1; i <= Length(input); i++ {
-		input[i-1] = string([]byte{UpCase(input[i-1])})
+		input[i-1] = UpCase(input[i-1])
 	}
 	toggle = true
 	if input[0] == '+' || input[0] == '-' {
@@ -1354,6 +1383,7 @@ func GamePlayLoop(boardChanged bool) {
 				ElementDefs[Board.Tiles[int16(Board.Stats[0].X)+InputDeltaX][int16(Board.Stats[0].Y)+InputDeltaY].Element].TouchProc(int16(Board.Stats[0].X)+InputDeltaX, int16(Board.Stats[0].Y)+InputDeltaY, 0, &InputDeltaX, &InputDeltaY)
 			}
 			if (InputDeltaX != 0 || InputDeltaY != 0) && ElementDefs[Board.Tiles[int16(Board.Stats[0].X)+InputDeltaX][int16(Board.Stats[0].Y)+InputDeltaY].Element].Walkable {
+				// Move player
 				if Board.Tiles[Board.Stats[0].X][Board.Stats[0].Y].Element == E_PLAYER {
 					MoveStat(0, int16(Board.Stats[0].X)+InputDeltaX, int16(Board.Stats[0].Y)+InputDeltaY)
 				} else {
@@ -1366,6 +1396,7 @@ func GamePlayLoop(boardChanged bool) {
 					DrawPlayerSurroundings(int16(Board.Stats[0].X), int16(Board.Stats[0].Y), 0)
 					DrawPlayerSurroundings(int16(Board.Stats[0].X)-InputDeltaX, int16(Board.Stats[0].Y)-InputDeltaY, 0)
 				}
+				// Unpause
 				GamePaused = false
 				SidebarClearLine(5)
 				CurrentTick = Random(100)
@@ -1373,6 +1404,7 @@ func GamePlayLoop(boardChanged bool) {
 				World.Info.IsSave = true
 			}
 		} else {
+			// not GamePaused
 			if CurrentStatTicked <= Board.StatCount {
 				stat := &Board.Stats[CurrentStatTicked]
 				if stat.Cycle != 0 && CurrentTick%stat.Cycle == CurrentStatTicked%stat.Cycle {
@@ -1382,7 +1414,9 @@ func GamePlayLoop(boardChanged bool) {
 			}
 		}
 		if CurrentStatTicked > Board.StatCount && !GamePlayExitRequested {
+			// all stats ticked
 			if SoundHasTimeElapsed(&TickTimeCounter, TickTimeDuration) {
+				// next cycle
 				CurrentTick++
 				if CurrentTick > 420 {
 					CurrentTick = 1
@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: GameVars
 
 const (
@@ -175,7 +197,7 @@ var (
 	EditorEnabled               bool
 	GameVersion                 string
 	ParsingConfigFile           bool
-	ResetConfig                 bool
+	ResetConfig                 bool // This flag is a remnant from ZZT 3.0.
 	JustStarted                 bool
 	WorldFileDescCount          int16
 	WorldFileDescKeys           [10]string
@@ -183,67 +205,71 @@ var (
 )
 
 const (
-	E_EMPTY                = 0
-	E_BOARD_EDGE           = 1
-	E_MESSAGE_TIMER        = 2
-	E_MONITOR              = 3
-	E_PLAYER               = 4
-	E_AMMO                 = 5
-	E_TORCH                = 6
-	E_GEM                  = 7
-	E_KEY                  = 8
-	E_DOOR                 = 9
-	E_SCROLL               = 10
-	E_PASSAGE              = 11
-	E_DUPLICATOR           = 12
-	E_BOMB                 = 13
-	E_ENERGIZER            = 14
-	E_STAR                 = 15
-	E_CONVEYOR_CW          = 16
-	E_CONVEYOR_CCW         = 17
-	E_BULLET               = 18
-	E_WATER                = 19
-	E_FOREST               = 20
-	E_SOLID                = 21
-	E_NORMAL               = 22
-	E_BREAKABLE            = 23
-	E_BOULDER              = 24
-	E_SLIDER_NS            = 25
-	E_SLIDER_EW            = 26
-	E_FAKE                 = 27
-	E_INVISIBLE            = 28
-	E_BLINK_WALL           = 29
-	E_TRANSPORTER          = 30
-	E_LINE                 = 31
-	E_RICOCHET             = 32
-	E_BLINK_RAY_EW         = 33
-	E_BEAR                 = 34
-	E_RUFFIAN              = 35
-	E_OBJECT               = 36
-	E_SLIME                = 37
-	E_SHARK                = 38
-	E_SPINNING_GUN         = 39
-	E_PUSHER               = 40
-	E_LION                 = 41
-	E_TIGER                = 42
-	E_BLINK_RAY_NS         = 43
-	E_CENTIPEDE_HEAD       = 44
-	E_CENTIPEDE_SEGMENT    = 45
-	E_TEXT_BLUE            = 47
-	E_TEXT_GREEN           = 48
-	E_TEXT_CYAN            = 49
-	E_TEXT_RED             = 50
-	E_TEXT_PURPLE          = 51
-	E_TEXT_YELLOW          = 52
-	E_TEXT_WHITE           = 53
-	E_TEXT_MIN             = E_TEXT_BLUE
-	CATEGORY_ITEM          = 1
-	CATEGORY_CREATURE      = 2
-	CATEGORY_TERRAIN       = 3
+	E_EMPTY             = 0
+	E_BOARD_EDGE        = 1
+	E_MESSAGE_TIMER     = 2
+	E_MONITOR           = 3 // State - Title screen
+	E_PLAYER            = 4 // State - Playing
+	E_AMMO              = 5
+	E_TORCH             = 6
+	E_GEM               = 7
+	E_KEY               = 8
+	E_DOOR              = 9
+	E_SCROLL            = 10
+	E_PASSAGE           = 11
+	E_DUPLICATOR        = 12
+	E_BOMB              = 13
+	E_ENERGIZER         = 14
+	E_STAR              = 15
+	E_CONVEYOR_CW       = 16
+	E_CONVEYOR_CCW      = 17
+	E_BULLET            = 18
+	E_WATER             = 19
+	E_FOREST            = 20
+	E_SOLID             = 21
+	E_NORMAL            = 22
+	E_BREAKABLE         = 23
+	E_BOULDER           = 24
+	E_SLIDER_NS         = 25
+	E_SLIDER_EW         = 26
+	E_FAKE              = 27
+	E_INVISIBLE         = 28
+	E_BLINK_WALL        = 29
+	E_TRANSPORTER       = 30
+	E_LINE              = 31
+	E_RICOCHET          = 32
+	E_BLINK_RAY_EW      = 33
+	E_BEAR              = 34
+	E_RUFFIAN           = 35
+	E_OBJECT            = 36
+	E_SLIME             = 37
+	E_SHARK             = 38
+	E_SPINNING_GUN      = 39
+	E_PUSHER            = 40
+	E_LION              = 41
+	E_TIGER             = 42
+	E_BLINK_RAY_NS      = 43
+	E_CENTIPEDE_HEAD    = 44
+	E_CENTIPEDE_SEGMENT = 45
+	E_TEXT_BLUE         = 47
+	E_TEXT_GREEN        = 48
+	E_TEXT_CYAN         = 49
+	E_TEXT_RED          = 50
+	E_TEXT_PURPLE       = 51
+	E_TEXT_YELLOW       = 52
+	E_TEXT_WHITE        = 53
+
+	E_TEXT_MIN = E_TEXT_BLUE
+
+	CATEGORY_ITEM     = 1
+	CATEGORY_CREATURE = 2
+	CATEGORY_TERRAIN  = 3
+
 	COLOR_SPECIAL_MIN      = 0xF0
 	COLOR_CHOICE_ON_BLACK  = 0xFF
 	COLOR_WHITE_ON_CHOICE  = 0xFE
 	COLOR_CHOICE_ON_CHOICE = 0xFD
-	SHOT_SOURCE_PLAYER     = 0
-	SHOT_SOURCE_ENEMY      = 1
+
+	SHOT_SOURCE_PLAYER = 0
+	SHOT_SOURCE_ENEMY  = 1
 )
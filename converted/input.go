@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: Input
 
 const (
@@ -147,6 +169,7 @@ CalibrationStart:
 	JoystickXMax -= JoystickXCenter
 	JoystickYMin -= JoystickYCenter
 	JoystickYMax -= JoystickYCenter
+	// if calibration valid range -> successful
 	if JoystickXMin < 1 && JoystickXMax > 1 && JoystickYMin < 1 && JoystickYMax > 1 {
 		InputJoystickEnabled = true
 	} else {
@@ -207,6 +230,7 @@ func InputUpdate() {
 		InputKeyPressed = '\x00'
 	}
 	if InputDeltaX != 0 || InputDeltaY != 0 {
+		// keyboard movement
 		KeysUpdateModifiers()
 		InputShiftPressed = KeysShiftHeld
 	} else if InputJoystickEnabled {
@@ -266,6 +290,7 @@ func InputUpdate() {
 
 		regs.AX = 0x03
 		Intr(0x33, regs)
+		// left mouse button
 		if regs.BX&1 != 0 {
 			if !InputShiftAccepted {
 				InputShiftPressed = true
@@ -273,6 +298,7 @@ func InputUpdate() {
 		} else {
 			InputShiftAccepted = false
 		}
+		// right/middle mouse button
 		if regs.BX&6 != 0 {
 			if InputDeltaX != 0 || InputDeltaY != 0 {
 				InputMouseButtonX = InputDeltaX
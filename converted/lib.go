@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
@@ -56,7 +57,10 @@ func StrWidth(n, width int16) string {
 }
 
 func WriteLn(args ...interface{}) {
-	// TODO
+	for _, arg := range args {
+		fmt.Print(arg)
+	}
+	fmt.Println()
 }
 
 // NOTE: in Turbo Pascal Delete() is a procedure that modifies the string in-place
@@ -163,6 +167,189 @@ func BoolToInt(b bool) int16 {
 	return 0
 }
 
+// Set functions
+
+// Set is a Pascal set: a bitset of the ordinal values 0 to 255, the
+// most that a Turbo Pascal set can hold.
+type Set [32]byte
+
+// SetOf returns a set containing the given values.
+func SetOf(values ...int) Set {
+	var s Set
+	for _, n := range values {
+		s.Include(n)
+	}
+	return s
+}
+
+// WithRange returns s with the values min to max added, for a set
+// constructor like [a..b].
+func (s Set) WithRange(min, max int) Set {
+	for n := min; n <= max; n++ {
+		s.Include(n)
+	}
+	return s
+}
+
+func (s *Set) Include(n int) {
+	s[n/8] |= 1 << uint(n%8)
+}
+
+func (s *Set) Exclude(n int) {
+	s[n/8] &^= 1 << uint(n%8)
+}
+
+func (s Set) Contains(n int) bool {
+	return n >= 0 && n < 256 && s[n/8]&(1<<uint(n%8)) != 0
+}
+
+func (s Set) Union(t Set) Set {
+	for i := range s {
+		s[i] |= t[i]
+	}
+	return s
+}
+
+func (s Set) Diff(t Set) Set {
+	for i := range s {
+		s[i] &^= t[i]
+	}
+	return s
+}
+
+func (s Set) Intersect(t Set) Set {
+	for i := range s {
+		s[i] &= t[i]
+	}
+	return s
+}
+
+// SubsetOf reports whether every value in s is also in t (s <= t).
+func (s Set) SubsetOf(t Set) bool {
+	for i := range s {
+		if s[i]&^t[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Variant record functions
+
+// The fields of a record's variant part are stored in a byte array in
+// Turbo Pascal's little-endian layout, so that writing one variant and
+// reading another works as it did in DOS. These load and store values
+// in such an array.
+
+func LoadUint16(b []byte) uint16 {
+	return binary.LittleEndian.Uint16(b)
+}
+
+func StoreUint16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+}
+
+func LoadUint32(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b)
+}
+
+func StoreUint32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b, v)
+}
+
+func LoadUint64(b []byte) uint64 {
+	return binary.LittleEndian.Uint64(b)
+}
+
+func StoreUint64(b []byte, v uint64) {
+	binary.LittleEndian.PutUint64(b, v)
+}
+
+func LoadSingle(b []byte) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
+
+func StoreSingle(b []byte, v float32) {
+	binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+}
+
+func LoadDouble(b []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func StoreDouble(b []byte, v float64) {
+	binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+}
+
+// LoadReal decodes a 6-byte Turbo Pascal Real: an exponent byte biased
+// by 129 (0 for the value 0), then a 39-bit mantissa with an implicit
+// leading 1, then the sign bit.
+func LoadReal(b []byte) float64 {
+	if b[0] == 0 {
+		return 0
+	}
+	mantissa := uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16 |
+		uint64(b[4])<<24 | uint64(b[5]&0x7f)<<32
+	v := math.Ldexp(1+float64(mantissa)/(1<<39), int(b[0])-129)
+	if b[5]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// StoreReal encodes v as a 6-byte Turbo Pascal Real (see LoadReal).
+func StoreReal(b []byte, v float64) {
+	for i := range b[:6] {
+		b[i] = 0
+	}
+	if v == 0 {
+		return
+	}
+	var sign byte
+	if v < 0 {
+		sign = 0x80
+		v = -v
+	}
+	frac, exp := math.Frexp(v) // v = frac * 2**exp, frac in [0.5, 1)
+	exp += 128                 // v = 1.m * 2**(exp-129)
+	mantissa := uint64(math.Round((frac*2 - 1) * (1 << 39)))
+	if mantissa == 1<<39 {
+		mantissa = 0
+		exp++
+	}
+	if exp <= 0 {
+		return // too small, underflows to 0
+	}
+	if exp > 255 {
+		panic("Runtime error 205: Floating point overflow")
+	}
+	b[0] = byte(exp)
+	b[1] = byte(mantissa)
+	b[2] = byte(mantissa >> 8)
+	b[3] = byte(mantissa >> 16)
+	b[4] = byte(mantissa >> 24)
+	b[5] = byte(mantissa>>32) | sign
+}
+
+// LoadString decodes a Pascal string: a length byte followed by the
+// characters.
+func LoadString(b []byte) string {
+	n := int(b[0])
+	if n > len(b)-1 {
+		n = len(b) - 1
+	}
+	return string(b[1 : 1+n])
+}
+
+// StoreString encodes s as a Pascal string, truncating it to fit.
+func StoreString(b []byte, s string) {
+	if len(s) > len(b)-1 {
+		s = s[:len(b)-1]
+	}
+	b[0] = byte(len(s))
+	copy(b[1:], s)
+}
+
 // File functions
 
 type File struct {
@@ -183,6 +370,26 @@ func setIOResult(err error) {
 	}
 }
 
+// CheckIO is called after each file operation in the {$I+} state. Like
+// Turbo Pascal, it stops with a runtime error if the operation failed.
+func CheckIO() {
+	if ioResult != 0 {
+		code := ioResult
+		ioResult = 0
+		panic(fmt.Sprintf("Runtime error %03d: I/O error", code))
+	}
+}
+
+// RangeCheck is called on a value being narrowed to a smaller integer
+// type in the {$R+} state. Like Turbo Pascal, it stops with a runtime
+// error if n is outside the range min..max.
+func RangeCheck(n, min, max int64) int64 {
+	if n < min || n > max {
+		panic("Runtime error 201: Range check error")
+	}
+	return n
+}
+
 func Assign(f *File, name string) {
 	f.name = name
 }
@@ -228,7 +435,7 @@ func Erase(f *File) {
 	setIOResult(err)
 }
 
-func Seek(f *File, offset int16) {
+func Seek(f *File, offset int32) {
 	_, err := f.file.Seek(int64(offset), io.SeekStart)
 	setIOResult(err)
 }
@@ -258,6 +465,10 @@ func New(p interface{}) {
 	// TODO
 }
 
+func Dispose(p interface{}) {
+	// TODO
+}
+
 func FreeMem(p interface{}, size int16) {
 	// TODO
 }
@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: Oop
 
 // interface uses: GameVars
@@ -79,9 +101,9 @@ func OopSkipLine(statId int16, position *int16) {
 	}
 }
 
-func OopParseDirection(statId int16, position *int16, dx, dy *int16) (OopParseDirection bool) {
+func OopParseDirection(statId int16, position *int16, dx, dy *int16) (result bool) {
 	stat := &Board.Stats[statId]
-	OopParseDirection = true
+	result = true
 	if OopWord == "N" || OopWord == "NORTH" {
 		*dx = 0
 		*dy = -1
@@ -116,15 +138,15 @@ func OopParseDirection(statId int16, position *int16, dx, dy *int16) (OopParseDi
 		}
 	} else if OopWord == "CW" {
 		OopReadWord(statId, position)
-		OopParseDirection = OopParseDirection(statId, position, dy, dx)
+		result = OopParseDirection(statId, position, dy, dx)
 		*dx = -*dx
 	} else if OopWord == "CCW" {
 		OopReadWord(statId, position)
-		OopParseDirection = OopParseDirection(statId, position, dy, dx)
+		result = OopParseDirection(statId, position, dy, dx)
 		*dy = -*dy
 	} else if OopWord == "RNDP" {
 		OopReadWord(statId, position)
-		OopParseDirection = OopParseDirection(statId, position, dy, dx)
+		result = OopParseDirection(statId, position, dy, dx)
 		if Random(2) == 0 {
 			*dx = -*dx
 		} else {
@@ -132,13 +154,13 @@ func OopParseDirection(statId int16, position *int16, dx, dy *int16) (OopParseDi
 		}
 	} else if OopWord == "OPP" {
 		OopReadWord(statId, position)
-		OopParseDirection = OopParseDirection(statId, position, dx, dy)
+		result = OopParseDirection(statId, position, dx, dy)
 		*dx = -*dx
 		*dy = -*dy
 	} else {
 		*dx = 0
 		*dy = 0
-		OopParseDirection = false
+		result = false
 	}
 
 	return
@@ -168,10 +190,13 @@ func OopFindString(statId int16, s string) (OopFindString int16) {
 				break
 			}
 		}
+		// string matches
 		OopReadChar(statId, &cmpPos)
 		OopChar = UpCase(OopChar)
 		if OopChar >= 'A' && OopChar <= 'Z' || OopChar == '_' {
+			// word continues, match invalid
 		} else {
+			// word complete, match valid
 			OopFindString = pos
 			return
 		}
@@ -240,25 +265,30 @@ func OopFindLabel(statId int16, sendLabel string, iStat, iDataPos *int16, labelP
 	)
 	foundStat = false
 	targetSplitPos = Pos(':', sendLabel)
-	if targetSplitPos <= 0 {
-		if *iStat < statId {
-			objectMessage = sendLabel
-			*iStat = statId
-			targetSplitPos = 0
-			foundStat = true
-		}
-	} else {
-		targetLookup = Copy(sendLabel, 1, targetSplitPos-1)
-		objectMessage = Copy(sendLabel, targetSplitPos+1, Length(sendLabel)-targetSplitPos)
-	FindNextStat:
-		foundStat = OopIterateStat(statId, iStat, targetLookup)
-
-	}
+	if !(targetSplitPos <= 0) {
+		goto ifElse1
+	}
+	// if there is no target, we only check statId
+	if *iStat < statId {
+		objectMessage = sendLabel
+		*iStat = statId
+		targetSplitPos = 0
+		foundStat = true
+	}
+	goto ifEnd1
+ifElse1:
+	targetLookup = Copy(sendLabel, 1, targetSplitPos-1)
+	objectMessage = Copy(sendLabel, targetSplitPos+1, Length(sendLabel)-targetSplitPos)
+FindNextStat:
+	foundStat = OopIterateStat(statId, iStat, targetLookup)
+
+ifEnd1:
 	if foundStat {
 		if objectMessage == "RESTART" {
 			*iDataPos = 0
 		} else {
 			*iDataPos = OopFindString(*iStat, labelPrefix+objectMessage)
+			// if lookup target exists, there may be more stats
 			if *iDataPos < 0 && targetSplitPos > 0 {
 				goto FindNextStat
 			}
@@ -405,7 +435,7 @@ func OopPlaceTile(x, y int16, tile *TTile) {
 	}
 }
 
-func OopCheckCondition(statId int16, position *int16) (OopCheckCondition bool) {
+func OopCheckCondition(statId int16, position *int16) (result bool) {
 	var (
 		deltaX, deltaY int16
 		tile           TTile
@@ -414,25 +444,25 @@ func OopCheckCondition(statId int16, position *int16) (OopCheckCondition bool) {
 	stat := &Board.Stats[statId]
 	if OopWord == "NOT" {
 		OopReadWord(statId, position)
-		OopCheckCondition = !OopCheckCondition(statId, position)
+		result = !OopCheckCondition(statId, position)
 	} else if OopWord == "ALLIGNED" {
-		OopCheckCondition = stat.X == Board.Stats[0].X || stat.Y == Board.Stats[0].Y
+		result = stat.X == Board.Stats[0].X || stat.Y == Board.Stats[0].Y
 	} else if OopWord == "CONTACT" {
-		OopCheckCondition = Sqr(int16(stat.X)-int16(Board.Stats[0].X))+Sqr(int16(stat.Y)-int16(Board.Stats[0].Y)) == 1
+		result = Sqr(int16(stat.X)-int16(Board.Stats[0].X))+Sqr(int16(stat.Y)-int16(Board.Stats[0].Y)) == 1
 	} else if OopWord == "BLOCKED" {
 		OopReadDirection(statId, position, &deltaX, &deltaY)
-		OopCheckCondition = !ElementDefs[Board.Tiles[int16(stat.X)+deltaX][int16(stat.Y)+deltaY].Element].Walkable
+		result = !ElementDefs[Board.Tiles[int16(stat.X)+deltaX][int16(stat.Y)+deltaY].Element].Walkable
 	} else if OopWord == "ENERGIZED" {
-		OopCheckCondition = World.Info.EnergizerTicks > 0
+		result = World.Info.EnergizerTicks > 0
 	} else if OopWord == "ANY" {
 		if !OopParseTile(&statId, position, &tile) {
 			OopError(statId, "Bad object kind")
 		}
 		ix = 0
 		iy = 1
-		OopCheckCondition = FindTileOnBoard(&ix, &iy, tile)
+		result = FindTileOnBoard(&ix, &iy, tile)
 	} else {
-		OopCheckCondition = WorldGetFlagPosition(OopWord) >= 0
+		result = WorldGetFlagPosition(OopWord) >= 0
 	}
 
 	return
@@ -456,6 +486,8 @@ func OopSend(statId int16, sendLabel string, ignoreLock bool) (OopSend bool) {
 		ignoreSelfLock  bool
 	)
 	if statId < 0 {
+		// if statId is negative, label send will always succeed on self
+		// this is used for in-game events (f.e. TOUCH, SHOT)
 		statId = -statId
 		ignoreSelfLock = true
 	} else {
@@ -514,6 +546,7 @@ StartParsing:
 
 		lastPosition = *position
 		OopReadChar(statId, position)
+		// skip labels
 		for OopChar == ':' {
 			for {
 				OopReadChar(statId, position)
@@ -778,7 +811,7 @@ StartParsing:
 		} else if OopChar == '\x00' {
 			endOfProgram = true
 		} else {
-			textLine = OopChar + OopReadLineToEnd(statId, position)
+			textLine = string([]byte{OopChar}) + OopReadLineToEnd(statId, position)
 			TextWindowAppend(&textWindow, textLine)
 		}
 
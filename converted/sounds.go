@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: Sounds
 
 type TDrumData struct {
@@ -132,13 +154,13 @@ func SoundHasTimeElapsed(counter *int16, duration int16) (SoundHasTimeElapsed bo
 	}
 	if UseSystemTimeForElapsed {
 		GetTime(&hour, &minute, &sec, &hSec)
-		hSecsTotal = int16(sec*100 + hSec)
-		hSecsDiff = uint16(hSecsTotal-*counter+6000) % 6000
+		hSecsTotal = int16(int32(sec)*100 + int32(hSec))
+		hSecsDiff = uint16(int32(uint16(hSecsTotal-*counter+6000)) % 6000)
 	} else {
-		hSecsTotal = int16(TimerTicks * 6)
+		hSecsTotal = int16(int32(TimerTicks) * 6)
 		hSecsDiff = uint16(hSecsTotal - *counter)
 	}
-	if hSecsDiff >= uint16(duration) {
+	if int32(hSecsDiff) >= int32(duration) {
 		SoundHasTimeElapsed = true
 		*counter = hSecsTotal
 	} else {
@@ -267,12 +289,12 @@ func SoundParse(input string) (SoundParse string) {
 				noteTone++
 				AdvanceInput()
 			}
-			output += Chr(byte(noteOctave*0x10+noteTone)) + Chr(byte(noteDuration))
+			output = output + Chr(byte(noteOctave*0x10+noteTone)) + Chr(byte(noteDuration))
 		case 'X':
-			output += "\x00" + Chr(byte(noteDuration))
+			output = output + "\x00" + Chr(byte(noteDuration))
 			AdvanceInput()
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-			output += Chr(Ord(input[0])+0xF0-Ord('0')) + Chr(byte(noteDuration))
+			output = output + Chr(Ord(input[0])+0xF0-Ord('0')) + Chr(byte(noteDuration))
 			AdvanceInput()
 		default:
 			AdvanceInput()
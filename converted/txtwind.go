@@ -1,3 +1,25 @@
+// Copyright (c) 2020 Adrian Siekierka
+//
+// Based on a reconstruction of code from ZZT,
+// Copyright 1991 Epic MegaGames, used with permission.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
 package main // unit: TxtWind
 
 // interface uses: Video
@@ -48,7 +70,7 @@ var (
 func UpCaseString(input string) (UpCaseString string) {
 	var i int16
 	for i = 1; i <= Length(input); i++ {
-		input[i-1] = string([]byte{UpCase(input[i-1])})
+		input[i-1] = UpCase(input[i-1])
 	}
 	UpCaseString = input
 	return
@@ -205,7 +227,7 @@ func TextWindowPrint(state *TTextWindowState) {
 	if state.LoadedFilename == "ORDER.HLP" {
 		WriteLn(Lst, *OrderPrintId)
 	}
-	Write(Lst, Chr(12))
+	Write(Lst, Chr(12)) // form feed
 	Close(Lst)
 }
 
@@ -226,7 +248,7 @@ func TextWindowSelect(state *TTextWindowState, hyperlinkAsSelect, viewingFile bo
 			newLinePos += InputDeltaY
 		} else if InputShiftPressed || InputKeyPressed == KEY_ENTER {
 			InputShiftAccepted = true
-			if *state.Lines[state.LinePos-1][0] == "!" {
+			if *state.Lines[state.LinePos-1][0] == '!' {
 				pointerStr = Copy(*state.Lines[state.LinePos-1], 2, Length(*state.Lines[state.LinePos-1])-1)
 				if Pos(';', pointerStr) > 0 {
 					pointerStr = Copy(pointerStr, 1, Pos(';', pointerStr)-1)
@@ -253,7 +275,7 @@ func TextWindowSelect(state *TTextWindowState, hyperlinkAsSelect, viewingFile bo
 							if Length(pointerStr) > Length(*state.Lines[iLine-1]) {
 							} else {
 								for iChar = 1; iChar <= Length(pointerStr); iChar++ {
-									if UpCase(pointerStr[iChar-1]) != UpCase(byte(*state.Lines[iLine-1][iChar-1])) {
+									if UpCase(pointerStr[iChar-1]) != UpCase(*state.Lines[iLine-1][iChar-1]) {
 										goto LabelNotMatched
 									}
 								}
@@ -288,7 +310,7 @@ func TextWindowSelect(state *TTextWindowState, hyperlinkAsSelect, viewingFile bo
 		if newLinePos != state.LinePos {
 			state.LinePos = newLinePos
 			TextWindowDraw(state, false, viewingFile)
-			if *state.Lines[state.LinePos-1][0] == "!" {
+			if *state.Lines[state.LinePos-1][0] == '!' {
 				if hyperlinkAsSelect {
 					TextWindowDrawTitle(0x1E, "\xaePress ENTER to select this\xaf")
 				} else {
@@ -351,7 +373,7 @@ func TextWindowEdit(state *TTextWindowState) {
 			charPos = Length(*state.Lines[state.LinePos-1]) + 1
 			VideoWriteText(charPos+TextWindowX+3, TextWindowY+TextWindowHeight/2+1, 0x70, " ")
 		} else {
-			VideoWriteText(charPos+TextWindowX+3, TextWindowY+TextWindowHeight/2+1, 0x70, *state.Lines[state.LinePos-1][charPos-1])
+			VideoWriteText(charPos+TextWindowX+3, TextWindowY+TextWindowHeight/2+1, 0x70, string([]byte{*state.Lines[state.LinePos-1][charPos-1]}))
 		}
 		InputReadWaitKey()
 		newLinePos = state.LinePos
@@ -407,11 +429,11 @@ func TextWindowEdit(state *TTextWindowState) {
 		default:
 			if InputKeyPressed >= ' ' && charPos < TextWindowWidth-7 {
 				if !insertMode {
-					*state.Lines[state.LinePos-1] = Copy(*state.Lines[state.LinePos-1], 1, charPos-1) + InputKeyPressed + Copy(*state.Lines[state.LinePos-1], charPos+1, Length(*state.Lines[state.LinePos-1])-charPos)
+					*state.Lines[state.LinePos-1] = Copy(*state.Lines[state.LinePos-1], 1, charPos-1) + string([]byte{InputKeyPressed}) + Copy(*state.Lines[state.LinePos-1], charPos+1, Length(*state.Lines[state.LinePos-1])-charPos)
 					charPos++
 				} else {
 					if Length(*state.Lines[state.LinePos-1]) < TextWindowWidth-8 {
-						*state.Lines[state.LinePos-1] = Copy(*state.Lines[state.LinePos-1], 1, charPos-1) + InputKeyPressed + Copy(*state.Lines[state.LinePos-1], charPos, Length(*state.Lines[state.LinePos-1])-charPos+1)
+						*state.Lines[state.LinePos-1] = Copy(*state.Lines[state.LinePos-1], 1, charPos-1) + string([]byte{InputKeyPressed}) + Copy(*state.Lines[state.LinePos-1], charPos, Length(*state.Lines[state.LinePos-1])-charPos+1)
 						charPos++
 					}
 				}
@@ -559,8 +581,8 @@ func TextWindowInit(x, y, width, height int16) {
 	TextWindowStrInnerEmpty = ""
 	TextWindowStrInnerLine = ""
 	for i = 1; i <= TextWindowWidth-5; i++ {
-		TextWindowStrInnerEmpty += ' '
-		TextWindowStrInnerLine += '\xcd'
+		TextWindowStrInnerEmpty += " "
+		TextWindowStrInnerLine += "\xcd"
 	}
 	TextWindowStrTop = "\xc6\xd1" + TextWindowStrInnerLine + "\xd1" + "\xb5"
 	TextWindowStrBottom = "\xc6\xcf" + TextWindowStrInnerLine + "\xcf" + "\xb5"
@@ -0,0 +1,3 @@
+module github.com/benhoyt/pas2go
+
+go 1.16
@@ -4,24 +4,69 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/benhoyt/pas2go/convert"
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/lexer"
+	"github.com/benhoyt/pas2go/pascal/parser"
+	"github.com/benhoyt/pas2go/pascal/token"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: pas2go [lex | parse | convert] [file.pas] [unit1.pas ...]\n")
+		fmt.Fprintf(os.Stderr, "usage: pas2go [lex | parse | convert] [flags] [file.pas] [unit1.pas ...]\n")
 		os.Exit(1)
 	}
 
 	command := os.Args[1]
 
+	flags := flag.NewFlagSet("pas2go "+command, flag.ExitOnError)
+	lineDirectives := flags.Bool("line-directives", false,
+		"convert: emit //line directives mapping Go code back to the Pascal source")
+	tpArith := flags.Bool("tp-arith", false,
+		"convert: do integer arithmetic at Turbo Pascal's intermediate width (int32)")
+	rangeChecks := flags.Bool("range-checks", false,
+		"convert: check integer ranges everywhere, as if compiling with {$R+}")
+	dialectName := flags.String("dialect", "tp",
+		"Pascal dialect: tp (Turbo Pascal) or delphi (also allows // comments and the Result variable)")
+	format := flags.String("format", "text",
+		"lex, parse: output format: text or json")
+	var defines stringList
+	flags.Var(&defines, "D",
+		"parse, convert: define `NAME` for {$IFDEF} (may be repeated)")
+	var includePath stringList
+	flags.Var(&includePath, "I",
+		"parse, convert: search `DIR` for {$I} include files (may be repeated)")
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+
+	parseOptions := parser.Options{Defines: defines, IncludePath: includePath}
+	switch *dialectName {
+	case "tp":
+		parseOptions.Dialect = lexer.TurboPascal
+	case "delphi":
+		parseOptions.Dialect = lexer.Delphi
+	default:
+		fmt.Fprintf(os.Stderr, "dialect must be 'tp' or 'delphi'\n")
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "format must be 'text' or 'json'\n")
+		os.Exit(1)
+	}
+
 	var src []byte
-	if len(os.Args) > 2 {
-		path := os.Args[2]
+	path := "stdin"
+	if len(args) > 0 {
+		path = args[0]
+		parseOptions.Filename = path
 		var err error
 		src, err = ioutil.ReadFile(path)
 		if err != nil {
@@ -39,63 +84,112 @@ func main() {
 
 	switch command {
 	case "lex":
-		lex(src)
+		lex(src, parseOptions, *format == "json")
 	case "parse":
-		file := parse(src)
+		file := parse(src, parseOptions)
+		if *format == "json" {
+			err := ast.EncodeJSON(os.Stdout, file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error encoding JSON: %v\n", err)
+				os.Exit(1)
+			}
+			break
+		}
 		fmt.Print(file)
 	case "convert":
-		file := parse(src)
+		file := parse(src, parseOptions)
 
-		units := []*Unit{}
-		for _, path := range os.Args[3:] {
+		units := []*ast.Unit{}
+		for _, path := range args[1:] {
 			unitSrc, err := ioutil.ReadFile(path)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
 				os.Exit(1)
 			}
-			unitFile := parse(unitSrc)
-			unit, ok := unitFile.(*Unit)
+			unitOptions := parseOptions
+			unitOptions.Filename = path
+			unitFile := parse(unitSrc, unitOptions)
+			unit, ok := unitFile.(*ast.Unit)
 			if !ok {
 				continue
 			}
 			units = append(units, unit)
 		}
 
-		Convert(file, units, os.Stdout)
+		options := convert.Options{
+			LineDirectives: *lineDirectives,
+			Filename:       path,
+			TPArith:        *tpArith,
+			RangeChecks:    *rangeChecks,
+			ResultVar:      parseOptions.Dialect == lexer.Delphi,
+		}
+		err := convert.Convert(file, units, os.Stdout, options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
 	default:
 		fmt.Fprintf(os.Stderr, "command must be 'lex' or 'parse'")
 		os.Exit(1)
 	}
 }
 
-func lex(src []byte) {
-	lexer := NewLexer(src)
+// lexToken is a single token as output by "lex -format=json".
+type lexToken struct {
+	Pos   token.Position `json:"pos"`
+	Token token.Token    `json:"token"`
+	Value string         `json:"value"`
+}
+
+func lex(src []byte, options parser.Options, asJSON bool) {
+	l := lexer.New(src, options.Filename, options.Dialect)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
 	for {
-		pos, tok, val := lexer.Scan()
-		if tok == EOF {
+		pos, tok, val := l.Scan()
+		if tok == token.EOF {
 			break
 		}
-		fmt.Printf("%d:%d %s %q\n", pos.Line, pos.Column, tok, val)
-		if tok == ILLEGAL {
+		if asJSON {
+			encoder.Encode(lexToken{pos, tok, val})
+		} else {
+			fmt.Printf("%d:%d %s %q\n", pos.Line, pos.Column, tok, val)
+		}
+		if tok == token.ILLEGAL {
 			break
 		}
 	}
 }
 
-func parse(src []byte) File {
-	file, err := Parse(src)
+func parse(src []byte, options parser.Options) ast.File {
+	file, err := parser.Parse(src, options)
 	if err != nil {
-		errMsg := fmt.Sprintf("%s", err)
-		if err, ok := err.(*ParseError); ok {
-			showSourceLine(src, err.Position, len(errMsg))
+		errs, ok := err.(parser.ErrorList)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		for _, err := range errs {
+			errMsg := err.Error()
+			lineSrc := src
+			if err.Position.Filename != options.Filename {
+				// Error is in an include file
+				var readErr error
+				lineSrc, readErr = ioutil.ReadFile(err.Position.Filename)
+				if readErr != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", errMsg)
+					continue
+				}
+			}
+			showSourceLine(lineSrc, err.Position, len(errMsg))
+			fmt.Fprintf(os.Stderr, "%s\n", errMsg)
 		}
-		fmt.Fprintf(os.Stderr, "%s\n", errMsg)
 		os.Exit(1)
 	}
 	return file
 }
 
-func showSourceLine(src []byte, pos Position, dividerLen int) {
+func showSourceLine(src []byte, pos token.Position, dividerLen int) {
 	divider := strings.Repeat("-", dividerLen)
 	if divider != "" {
 		fmt.Fprintln(os.Stderr, divider)
@@ -110,3 +204,16 @@ func showSourceLine(src []byte, pos Position, dividerLen int) {
 		fmt.Fprintln(os.Stderr, divider)
 	}
 }
+
+// stringList is a flag.Value that collects the values of a flag
+// that's given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
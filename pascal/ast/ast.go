@@ -1,15 +1,17 @@
-// Turbo Pascal abstract syntax tree (AST) type
-
-package main
+// Package ast defines the Turbo Pascal abstract syntax tree (AST)
+// types.
+package ast
 
 import (
 	"fmt"
 	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/token"
 )
 
 type File interface {
+	Node
 	file()
-	String() string
 }
 
 func (f *Program) file() {}
@@ -20,6 +22,12 @@ type Program struct {
 	Uses  []string
 	Decls []DeclPart
 	Stmt  *CompoundStmt
+	Span
+
+	Doc        []*token.Comment // comments before "program" keyword
+	Comments   CommentMap
+	Directives []*Directive
+	Switches   SwitchMap
 }
 
 func (p *Program) String() string {
@@ -58,6 +66,12 @@ type Unit struct {
 	ImplementationUses []string
 	Implementation     []DeclPart
 	Init               *CompoundStmt
+	Span
+
+	Doc        []*token.Comment // comments before "unit" keyword
+	Comments   CommentMap
+	Directives []*Directive
+	Switches   SwitchMap
 }
 
 func (u *Unit) String() string {
@@ -84,9 +98,65 @@ func indent(s string) string {
 	return strings.Join(strs, "\n")
 }
 
+// Node is the interface implemented by all AST nodes that have a
+// source span.
+type Node interface {
+	Pos() token.Position
+	End() token.Position
+	String() string
+}
+
+// Directive is a compiler directive such as {$I-} or (*$M 16384,0,0*).
+type Directive struct {
+	Span
+	Text string // text after the "$", for example "I-"
+}
+
+// SwitchMap maps each statement to the switch state at its start.
+type SwitchMap map[Stmt]token.Switches
+
+// Comments holds the comments attached to a node: those on the lines
+// before it, and those after it on the same line (or inside it, for a
+// simple statement). End holds the comments at the end of a block,
+// after its last statement: before the "end" of a compound statement,
+// before the "else" or "end" after a case element, before the "end"
+// of a case statement's "else" part, or after the end of a program or
+// unit.
+type Comments struct {
+	Leading  []*token.Comment
+	Trailing []*token.Comment
+	End      []*token.Comment
+}
+
+// CommentMap maps declaration, statement, case element, record field,
+// program, and unit nodes to their comments. Nodes without comments
+// aren't in the map.
+type CommentMap map[Node]*Comments
+
+// Span is the range of source code an AST node was parsed from. It's
+// embedded in each declaration, type, statement, and expression node.
+// Nodes created by the converter rather than the parser have a zero
+// Span.
+type Span struct {
+	StartPos token.Position // start of the node's first token
+	EndPos   token.Position // just past the end of the node's last token
+}
+
+// Pos returns the position of the start of the node.
+func (s Span) Pos() token.Position {
+	return s.StartPos
+}
+
+// End returns the position just past the end of the node.
+func (s Span) End() token.Position {
+	return s.EndPos
+}
+
 type DeclPart interface {
 	declPart()
 	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 func (p *ConstDecls) declPart() {}
@@ -98,6 +168,7 @@ func (p *VarDecls) declPart()   {}
 
 type ConstDecls struct {
 	Decls []*ConstDecl
+	Span
 }
 
 func (d *ConstDecls) String() string {
@@ -112,6 +183,7 @@ type ConstDecl struct {
 	Name  string
 	Type  TypeSpec
 	Value Expr
+	Span
 }
 
 func (d *ConstDecl) String() string {
@@ -123,11 +195,17 @@ func (d *ConstDecl) String() string {
 }
 
 type FuncDecl struct {
-	Name   string
-	Params []*ParamGroup
-	Result *TypeIdent
-	Decls  []DeclPart
-	Stmt   *CompoundStmt
+	Object   *TypeIdent // object type of a method implementation, or nil
+	Name     string
+	Params   []*ParamGroup
+	Result   *TypeIdent // nil if omitted from an earlier declared function
+	Virtual  bool       // method heading in an object type marked "virtual"
+	Forward  bool       // "forward" declaration, defined later on
+	External bool       // "external" declaration, implemented outside Pascal
+	Inline   []Expr     // machine code of an "inline" declaration, or nil
+	Decls    []DeclPart
+	Stmt     *CompoundStmt
+	Span
 }
 
 func (d *FuncDecl) String() string {
@@ -139,12 +217,49 @@ func (d *FuncDecl) String() string {
 	if d.Stmt != nil {
 		stmtStr = "\n" + indent(d.Stmt.String()) + ";\n"
 	}
-	return fmt.Sprintf("function %s%s: %s;%s%s",
-		d.Name, formatParams(d.Params), d.Result, declsStr, stmtStr)
+	resultStr := ""
+	if d.Result != nil {
+		resultStr = ": " + d.Result.String()
+	}
+	return fmt.Sprintf("function %s%s%s;%s%s%s%s",
+		methodName(d.Object, d.Name), formatParams(d.Params), resultStr,
+		formatVirtual(d.Virtual), formatDirective(d.Forward, d.External, d.Inline),
+		declsStr, stmtStr)
+}
+
+func methodName(object *TypeIdent, name string) string {
+	if object != nil {
+		return object.Name + "." + name
+	}
+	return name
+}
+
+func formatVirtual(virtual bool) string {
+	if virtual {
+		return " virtual;"
+	}
+	return ""
+}
+
+func formatDirective(forward, external bool, inline []Expr) string {
+	switch {
+	case forward:
+		return " forward;"
+	case external:
+		return " external;"
+	case inline != nil:
+		strs := make([]string, len(inline))
+		for i, expr := range inline {
+			strs[i] = expr.String()
+		}
+		return " inline(" + strings.Join(strs, "/") + ");"
+	}
+	return ""
 }
 
 type TypeIdent struct {
 	Name string
+	Span
 }
 
 func (t *TypeIdent) String() string {
@@ -155,6 +270,7 @@ type ParamGroup struct {
 	IsVar bool
 	Names []string
 	Type  *TypeIdent
+	Span
 }
 
 func (g *ParamGroup) String() string {
@@ -167,6 +283,7 @@ func (g *ParamGroup) String() string {
 
 type LabelDecls struct {
 	Labels []string
+	Span
 }
 
 func (d *LabelDecls) String() string {
@@ -174,10 +291,38 @@ func (d *LabelDecls) String() string {
 }
 
 type ProcDecl struct {
-	Name   string
-	Params []*ParamGroup
-	Decls  []DeclPart
-	Stmt   *CompoundStmt
+	Kind     ProcKind
+	Object   *TypeIdent // object type of a method implementation, or nil
+	Name     string
+	Params   []*ParamGroup
+	Virtual  bool   // method heading in an object type marked "virtual"
+	Forward  bool   // "forward" declaration, defined later on
+	External bool   // "external" declaration, implemented outside Pascal
+	Inline   []Expr // machine code of an "inline" declaration, or nil
+	Decls    []DeclPart
+	Stmt     *CompoundStmt
+	Span
+}
+
+// ProcKind is the keyword a procedure is declared with: constructors
+// and destructors are procedure methods of object types.
+type ProcKind int
+
+const (
+	Procedure ProcKind = iota
+	Constructor
+	Destructor
+)
+
+func (k ProcKind) String() string {
+	switch k {
+	case Constructor:
+		return "constructor"
+	case Destructor:
+		return "destructor"
+	default:
+		return "procedure"
+	}
 }
 
 func formatParams(params []*ParamGroup) string {
@@ -201,12 +346,15 @@ func (d *ProcDecl) String() string {
 	if d.Stmt != nil {
 		stmtStr = "\n" + indent(d.Stmt.String()) + ";\n"
 	}
-	return fmt.Sprintf("procedure %s%s;%s%s",
-		d.Name, formatParams(d.Params), declsStr, stmtStr)
+	return fmt.Sprintf("%s %s%s;%s%s%s%s",
+		d.Kind, methodName(d.Object, d.Name), formatParams(d.Params),
+		formatVirtual(d.Virtual), formatDirective(d.Forward, d.External, d.Inline),
+		declsStr, stmtStr)
 }
 
 type TypeDefs struct {
 	Defs []*TypeDef
+	Span
 }
 
 func (d *TypeDefs) String() string {
@@ -220,6 +368,7 @@ func (d *TypeDefs) String() string {
 type TypeDef struct {
 	Name string
 	Type TypeSpec
+	Span
 }
 
 func (d *TypeDef) String() string {
@@ -229,21 +378,27 @@ func (d *TypeDef) String() string {
 type TypeSpec interface {
 	typeSpec()
 	String() string
-}
-
-func (s *FuncSpec) typeSpec()    {}
-func (s *ProcSpec) typeSpec()    {}
-func (s *ScalarSpec) typeSpec()  {}
-func (s *IdentSpec) typeSpec()   {}
-func (s *StringSpec) typeSpec()  {}
-func (s *ArraySpec) typeSpec()   {}
-func (s *RecordSpec) typeSpec()  {}
-func (s *FileSpec) typeSpec()    {}
-func (s *PointerSpec) typeSpec() {}
+	Pos() token.Position
+	End() token.Position
+}
+
+func (s *FuncSpec) typeSpec()     {}
+func (s *ProcSpec) typeSpec()     {}
+func (s *ScalarSpec) typeSpec()   {}
+func (s *IdentSpec) typeSpec()    {}
+func (s *StringSpec) typeSpec()   {}
+func (s *ArraySpec) typeSpec()    {}
+func (s *RecordSpec) typeSpec()   {}
+func (s *FileSpec) typeSpec()     {}
+func (s *PointerSpec) typeSpec()  {}
+func (s *SetSpec) typeSpec()      {}
+func (s *SubrangeSpec) typeSpec() {}
+func (s *ObjectSpec) typeSpec()   {}
 
 type FuncSpec struct {
 	Params []*ParamGroup
 	Result *TypeIdent
+	Span
 }
 
 func (s *FuncSpec) String() string {
@@ -252,6 +407,7 @@ func (s *FuncSpec) String() string {
 
 type ProcSpec struct {
 	Params []*ParamGroup
+	Span
 }
 
 func (s *ProcSpec) String() string {
@@ -260,6 +416,7 @@ func (s *ProcSpec) String() string {
 
 type ScalarSpec struct {
 	Names []string
+	Span
 }
 
 func (s *ScalarSpec) String() string {
@@ -268,6 +425,7 @@ func (s *ScalarSpec) String() string {
 
 type IdentSpec struct {
 	Type *TypeIdent
+	Span
 }
 
 func (s *IdentSpec) String() string {
@@ -276,6 +434,7 @@ func (s *IdentSpec) String() string {
 
 type StringSpec struct {
 	Size int
+	Span
 }
 
 func (s *StringSpec) String() string {
@@ -283,17 +442,26 @@ func (s *StringSpec) String() string {
 }
 
 type ArraySpec struct {
-	Min Expr
-	Max Expr
-	Of  TypeSpec
+	// Index bounds, or nil if the index type is given by name (as in
+	// array[TIndex] or array[Char]), in which case Index is set
+	Min   Expr
+	Max   Expr
+	Index TypeSpec
+	Of    TypeSpec
+	Span
 }
 
 func (s *ArraySpec) String() string {
+	if s.Index != nil {
+		return fmt.Sprintf("array[%s] of %s", s.Index, s.Of)
+	}
 	return fmt.Sprintf("array[%s .. %s] of %s", s.Min, s.Max, s.Of)
 }
 
 type RecordSpec struct {
 	Sections []*RecordSection
+	Variant  *RecordVariant // variant part after the fixed fields, or nil
+	Span
 }
 
 func (s *RecordSpec) String() string {
@@ -301,6 +469,78 @@ func (s *RecordSpec) String() string {
 	for _, section := range s.Sections {
 		strs = append(strs, indent(section.String())+";\n")
 	}
+	if s.Variant != nil {
+		strs = append(strs, indent(s.Variant.String())+"\n")
+	}
+	strs = append(strs, "end")
+	return strings.Join(strs, "")
+}
+
+// RecordVariant is the "case" part of a record, whose cases share
+// the same memory.
+type RecordVariant struct {
+	Tag   string     // name of the tag field, or "" if there isn't one
+	Type  *TypeIdent // type of the tag
+	Cases []*VariantCase
+	Span
+}
+
+func (v *RecordVariant) String() string {
+	tagStr := v.Type.String()
+	if v.Tag != "" {
+		tagStr = v.Tag + ": " + tagStr
+	}
+	caseStrs := make([]string, len(v.Cases))
+	for i, c := range v.Cases {
+		caseStrs[i] = indent(c.String())
+	}
+	return fmt.Sprintf("case %s of\n%s", tagStr, strings.Join(caseStrs, ";\n"))
+}
+
+type VariantCase struct {
+	Consts   []Expr
+	Sections []*RecordSection
+	Variant  *RecordVariant // nested variant part, or nil
+	Span
+}
+
+func (c *VariantCase) String() string {
+	constStrs := make([]string, len(c.Consts))
+	for i, c := range c.Consts {
+		constStrs[i] = c.String()
+	}
+	fieldStrs := make([]string, len(c.Sections))
+	for i, section := range c.Sections {
+		fieldStrs[i] = section.String()
+	}
+	if c.Variant != nil {
+		fieldStrs = append(fieldStrs, c.Variant.String())
+	}
+	return fmt.Sprintf("%s: (%s)", strings.Join(constStrs, ", "), strings.Join(fieldStrs, "; "))
+}
+
+// ObjectSpec is a Turbo Pascal 5.5 object type: a record with
+// methods, which can inherit the fields and methods of a parent
+// object type.
+type ObjectSpec struct {
+	Parent   *TypeIdent // parent object type, or nil
+	Sections []*RecordSection
+	Methods  []DeclPart // method headings (*ProcDecl or *FuncDecl)
+	Span
+}
+
+func (s *ObjectSpec) String() string {
+	strs := []string{"object"}
+	if s.Parent != nil {
+		strs = append(strs, "(", s.Parent.String(), ")")
+	}
+	strs = append(strs, "\n")
+	for _, section := range s.Sections {
+		strs = append(strs, indent(section.String())+";\n")
+	}
+	for _, method := range s.Methods {
+		strs = append(strs, indent(method.String())+"\n")
+	}
 	strs = append(strs, "end")
 	return strings.Join(strs, "")
 }
@@ -308,6 +548,7 @@ func (s *RecordSpec) String() string {
 type RecordSection struct {
 	Names []string
 	Type  TypeSpec
+	Span
 }
 
 func (s *RecordSection) String() string {
@@ -316,6 +557,7 @@ func (s *RecordSection) String() string {
 
 type FileSpec struct {
 	Of TypeSpec
+	Span
 }
 
 func (s *FileSpec) String() string {
@@ -327,14 +569,35 @@ func (s *FileSpec) String() string {
 
 type PointerSpec struct {
 	Type *TypeIdent
+	Span
 }
 
 func (s *PointerSpec) String() string {
 	return "^" + s.Type.String()
 }
 
+type SubrangeSpec struct {
+	Min Expr
+	Max Expr
+	Span
+}
+
+func (s *SubrangeSpec) String() string {
+	return fmt.Sprintf("%s .. %s", s.Min, s.Max)
+}
+
+type SetSpec struct {
+	Of TypeSpec
+	Span
+}
+
+func (s *SetSpec) String() string {
+	return fmt.Sprintf("set of %s", s.Of)
+}
+
 type VarDecls struct {
 	Decls []*VarDecl
+	Span
 }
 
 func (d *VarDecls) String() string {
@@ -348,6 +611,7 @@ func (d *VarDecls) String() string {
 type VarDecl struct {
 	Names []string
 	Type  TypeSpec
+	Span
 }
 
 func (d *VarDecl) String() string {
@@ -359,6 +623,8 @@ func (d *VarDecl) String() string {
 type Stmt interface {
 	stmt()
 	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 func (s *AssignStmt) stmt()   {}
@@ -378,6 +644,7 @@ type AssignStmt struct {
 	TypeConv *TypeIdent
 	Var      Expr
 	Value    Expr
+	Span
 }
 
 func (s *AssignStmt) String() string {
@@ -393,6 +660,7 @@ type CaseStmt struct {
 	Selector Expr
 	Cases    []*CaseElement
 	Else     []Stmt
+	Span
 }
 
 func (s *CaseStmt) String() string {
@@ -411,6 +679,7 @@ func (s *CaseStmt) String() string {
 type CaseElement struct {
 	Consts []Expr
 	Stmt   Stmt
+	Span
 }
 
 func (e *CaseElement) String() string {
@@ -423,6 +692,7 @@ func (e *CaseElement) String() string {
 
 type CompoundStmt struct {
 	Stmts []Stmt
+	Span
 }
 
 func formatStmts(stmts []Stmt) string {
@@ -440,18 +710,21 @@ func (s *CompoundStmt) String() string {
 	return "begin\n" + indent(formatStmts(s.Stmts)) + "\nend"
 }
 
-type EmptyStmt struct{}
+type EmptyStmt struct {
+	Span
+}
 
 func (s *EmptyStmt) String() string {
 	return ""
 }
 
 type ForStmt struct {
-	Var     string
+	Var     *IdentExpr
 	Initial Expr
 	Down    bool
 	Final   Expr
 	Stmt    Stmt
+	Span
 }
 
 func (s *ForStmt) String() string {
@@ -465,6 +738,7 @@ func (s *ForStmt) String() string {
 
 type GotoStmt struct {
 	Label string
+	Span
 }
 
 func (s *GotoStmt) String() string {
@@ -475,6 +749,7 @@ type IfStmt struct {
 	Cond Expr
 	Then Stmt
 	Else Stmt
+	Span
 }
 
 func formatCompound(stmt Stmt) string {
@@ -509,6 +784,7 @@ func (s *IfStmt) String() string {
 type LabelledStmt struct {
 	Label string
 	Stmt  Stmt
+	Span
 }
 
 func (s *LabelledStmt) String() string {
@@ -518,6 +794,7 @@ func (s *LabelledStmt) String() string {
 type ProcStmt struct {
 	Proc Expr
 	Args []Expr
+	Span
 }
 
 func formatArgList(args []Expr) string {
@@ -539,6 +816,7 @@ func (s *ProcStmt) String() string {
 type RepeatStmt struct {
 	Stmts []Stmt
 	Cond  Expr
+	Span
 }
 
 func (s *RepeatStmt) String() string {
@@ -548,6 +826,7 @@ func (s *RepeatStmt) String() string {
 type WhileStmt struct {
 	Cond Expr
 	Stmt Stmt
+	Span
 }
 
 func (s *WhileStmt) String() string {
@@ -557,6 +836,7 @@ func (s *WhileStmt) String() string {
 type WithStmt struct {
 	Var  Expr
 	Stmt Stmt
+	Span
 }
 
 func (s *WithStmt) String() string {
@@ -568,6 +848,8 @@ func (s *WithStmt) String() string {
 type Expr interface {
 	expr()
 	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 func (e *AtExpr) expr()          {}
@@ -589,6 +871,7 @@ func (e *WidthExpr) expr()       {}
 
 type AtExpr struct {
 	Expr Expr
+	Span
 }
 
 func (e *AtExpr) String() string {
@@ -597,17 +880,42 @@ func (e *AtExpr) String() string {
 
 type BinaryExpr struct {
 	Left  Expr
-	Op    Token
+	Op    token.Token
 	Right Expr
+	Span
 }
 
 func (e *BinaryExpr) String() string {
-	return fmt.Sprintf("%s %s %s", e.Left, strings.ToLower(e.Op.String()), e.Right)
+	// Parenthesize operands whose grouping wouldn't otherwise be
+	// visible, so the output shows the actual shape of the tree.
+	left := e.Left.String()
+	if l, ok := e.Left.(*BinaryExpr); ok && precedence(l.Op) < precedence(e.Op) {
+		left = "(" + left + ")"
+	}
+	right := e.Right.String()
+	if r, ok := e.Right.(*BinaryExpr); ok && precedence(r.Op) <= precedence(e.Op) {
+		right = "(" + right + ")"
+	}
+	return fmt.Sprintf("%s %s %s", left, strings.ToLower(e.Op.String()), right)
+}
+
+// precedence returns the Turbo Pascal precedence level of the given
+// binary operator (higher binds more tightly).
+func precedence(op token.Token) int {
+	switch op {
+	case token.STAR, token.SLASH, token.DIV, token.MOD, token.AND, token.SHL, token.SHR:
+		return 3
+	case token.PLUS, token.MINUS, token.OR, token.XOR:
+		return 2
+	default: // relational operators
+		return 1
+	}
 }
 
 type ConstExpr struct {
 	Value interface{}
 	IsHex bool
+	Span
 }
 
 func (e *ConstExpr) String() string {
@@ -658,6 +966,7 @@ func escapeString(s string) string {
 
 type ConstArrayExpr struct {
 	Values []Expr
+	Span
 }
 
 func (e *ConstArrayExpr) String() string {
@@ -670,6 +979,7 @@ func (e *ConstArrayExpr) String() string {
 
 type ConstRecordExpr struct {
 	Fields []*ConstField
+	Span
 }
 
 func (e *ConstRecordExpr) String() string {
@@ -683,6 +993,7 @@ func (e *ConstRecordExpr) String() string {
 type ConstField struct {
 	Name  string
 	Value Expr
+	Span
 }
 
 func (f *ConstField) String() string {
@@ -692,6 +1003,7 @@ func (f *ConstField) String() string {
 type DotExpr struct {
 	Record Expr
 	Field  string
+	Span
 }
 
 func (e *DotExpr) String() string {
@@ -701,6 +1013,7 @@ func (e *DotExpr) String() string {
 type FuncExpr struct {
 	Func Expr
 	Args []Expr
+	Span
 }
 
 func (e *FuncExpr) String() string {
@@ -709,6 +1022,7 @@ func (e *FuncExpr) String() string {
 
 type IdentExpr struct {
 	Name string
+	Span
 }
 
 func (e *IdentExpr) String() string {
@@ -718,6 +1032,7 @@ func (e *IdentExpr) String() string {
 type IndexExpr struct {
 	Array Expr
 	Index Expr
+	Span
 }
 
 func (e *IndexExpr) String() string {
@@ -726,6 +1041,7 @@ func (e *IndexExpr) String() string {
 
 type ParenExpr struct {
 	Expr Expr
+	Span
 }
 
 func (e *ParenExpr) String() string {
@@ -734,6 +1050,7 @@ func (e *ParenExpr) String() string {
 
 type PointerExpr struct {
 	Expr Expr
+	Span
 }
 
 func (e *PointerExpr) String() string {
@@ -743,6 +1060,7 @@ func (e *PointerExpr) String() string {
 type RangeExpr struct {
 	Min Expr
 	Max Expr
+	Span
 }
 
 func (e *RangeExpr) String() string {
@@ -751,6 +1069,7 @@ func (e *RangeExpr) String() string {
 
 type SetExpr struct {
 	Values []Expr
+	Span
 }
 
 func (e *SetExpr) String() string {
@@ -764,6 +1083,7 @@ func (e *SetExpr) String() string {
 type TypeConvExpr struct {
 	Type *TypeIdent
 	Expr Expr
+	Span
 }
 
 func (e *TypeConvExpr) String() string {
@@ -773,8 +1093,9 @@ func (e *TypeConvExpr) String() string {
 }
 
 type UnaryExpr struct {
-	Op   Token
+	Op   token.Token
 	Expr Expr
+	Span
 }
 
 func (e *UnaryExpr) String() string {
@@ -788,6 +1109,7 @@ func (e *UnaryExpr) String() string {
 type WidthExpr struct {
 	Expr  Expr
 	Width Expr
+	Span
 }
 
 func (e *WidthExpr) String() string {
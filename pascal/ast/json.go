@@ -0,0 +1,102 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// EncodeJSON writes node and its children to w as indented JSON.
+// Each node is an object whose "node" key is the Go type name from
+// this package (for example "IfStmt"), followed by "pos" and "end"
+// for nodes with a Span, then the node's fields using their Go names.
+// Tokens are encoded by name and absent children as null.
+//
+// The CommentMap and SwitchMap of a Program or Unit are not encoded,
+// as they're keyed by node.
+func EncodeJSON(w io.Writer, node Node) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(jsonValue(reflect.ValueOf(node)))
+}
+
+var spanType = reflect.TypeOf(Span{})
+
+func jsonValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return jsonValue(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = jsonValue(v.Index(i))
+		}
+		return values
+	case reflect.Struct:
+		if comment, isComment := v.Interface().(token.Comment); isComment {
+			return jsonObject{{"node", "Comment"}, {"pos", comment.StartPos}, {"end", comment.EndPos}, {"Text", comment.Text}}
+		}
+		if v.Type().PkgPath() != spanType.PkgPath() {
+			return v.Interface() // token.Position
+		}
+		obj := jsonObject{{"node", v.Type().Name()}}
+		if f := v.FieldByName("Span"); f.IsValid() {
+			span := f.Interface().(Span)
+			obj = append(obj, jsonField{"pos", span.StartPos}, jsonField{"end", span.EndPos})
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Type == spanType || field.Type.Kind() == reflect.Map {
+				continue
+			}
+			obj = append(obj, jsonField{field.Name, jsonValue(v.Field(i))})
+		}
+		return obj
+	default:
+		return v.Interface()
+	}
+}
+
+// jsonObject is a JSON object that keeps its keys in order, so that
+// "node" comes first and fields are in declaration order.
+type jsonObject []jsonField
+
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		err := encoder.Encode(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1) // remove Encode's trailing newline
+		buf.WriteByte(':')
+		err = encoder.Encode(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
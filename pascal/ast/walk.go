@@ -0,0 +1,287 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by
+// Walk. If the result visitor w is not nil, Walk visits each of the
+// children of node with the visitor w, followed by a call of
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: it starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor
+// w for each of the non-nil children of node, followed by a call of
+// w.Visit(nil).
+//
+// Comments and switch directives are not visited, as they're stored
+// in the file's CommentMap and SwitchMap rather than in the tree
+// itself.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// Files
+	case *Program:
+		walkDecls(v, n.Decls)
+		if n.Stmt != nil {
+			Walk(v, n.Stmt)
+		}
+	case *Unit:
+		walkDecls(v, n.Interface)
+		walkDecls(v, n.Implementation)
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+
+	// Declarations
+	case *ConstDecls:
+		for _, decl := range n.Decls {
+			Walk(v, decl)
+		}
+	case *ConstDecl:
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		Walk(v, n.Value)
+	case *FuncDecl:
+		if n.Object != nil {
+			Walk(v, n.Object)
+		}
+		walkParams(v, n.Params)
+		if n.Result != nil {
+			Walk(v, n.Result)
+		}
+		walkExprs(v, n.Inline)
+		walkDecls(v, n.Decls)
+		if n.Stmt != nil {
+			Walk(v, n.Stmt)
+		}
+	case *TypeIdent:
+		// nothing to do
+	case *ParamGroup:
+		Walk(v, n.Type)
+	case *LabelDecls:
+		// nothing to do
+	case *ProcDecl:
+		if n.Object != nil {
+			Walk(v, n.Object)
+		}
+		walkParams(v, n.Params)
+		walkExprs(v, n.Inline)
+		walkDecls(v, n.Decls)
+		if n.Stmt != nil {
+			Walk(v, n.Stmt)
+		}
+	case *TypeDefs:
+		for _, def := range n.Defs {
+			Walk(v, def)
+		}
+	case *TypeDef:
+		Walk(v, n.Type)
+	case *VarDecls:
+		for _, decl := range n.Decls {
+			Walk(v, decl)
+		}
+	case *VarDecl:
+		Walk(v, n.Type)
+
+	// Type specs
+	case *FuncSpec:
+		walkParams(v, n.Params)
+		Walk(v, n.Result)
+	case *ProcSpec:
+		walkParams(v, n.Params)
+	case *ScalarSpec, *StringSpec:
+		// nothing to do
+	case *IdentSpec:
+		Walk(v, n.Type)
+	case *ArraySpec:
+		if n.Index != nil {
+			Walk(v, n.Index)
+		} else {
+			Walk(v, n.Min)
+			Walk(v, n.Max)
+		}
+		Walk(v, n.Of)
+	case *RecordSpec:
+		for _, section := range n.Sections {
+			Walk(v, section)
+		}
+		if n.Variant != nil {
+			Walk(v, n.Variant)
+		}
+	case *RecordSection:
+		Walk(v, n.Type)
+	case *ObjectSpec:
+		if n.Parent != nil {
+			Walk(v, n.Parent)
+		}
+		for _, section := range n.Sections {
+			Walk(v, section)
+		}
+		walkDecls(v, n.Methods)
+	case *RecordVariant:
+		Walk(v, n.Type)
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+	case *VariantCase:
+		walkExprs(v, n.Consts)
+		for _, section := range n.Sections {
+			Walk(v, section)
+		}
+		if n.Variant != nil {
+			Walk(v, n.Variant)
+		}
+	case *FileSpec:
+		if n.Of != nil {
+			Walk(v, n.Of)
+		}
+	case *PointerSpec:
+		Walk(v, n.Type)
+	case *SetSpec:
+		Walk(v, n.Of)
+	case *SubrangeSpec:
+		Walk(v, n.Min)
+		Walk(v, n.Max)
+
+	// Statements
+	case *AssignStmt:
+		if n.TypeConv != nil {
+			Walk(v, n.TypeConv)
+		}
+		Walk(v, n.Var)
+		Walk(v, n.Value)
+	case *CaseStmt:
+		Walk(v, n.Selector)
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+		walkStmts(v, n.Else)
+	case *CaseElement:
+		walkExprs(v, n.Consts)
+		Walk(v, n.Stmt)
+	case *CompoundStmt:
+		walkStmts(v, n.Stmts)
+	case *EmptyStmt, *GotoStmt:
+		// nothing to do
+	case *ForStmt:
+		Walk(v, n.Var)
+		Walk(v, n.Initial)
+		Walk(v, n.Final)
+		Walk(v, n.Stmt)
+	case *IfStmt:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *LabelledStmt:
+		Walk(v, n.Stmt)
+	case *ProcStmt:
+		Walk(v, n.Proc)
+		walkExprs(v, n.Args)
+	case *RepeatStmt:
+		walkStmts(v, n.Stmts)
+		Walk(v, n.Cond)
+	case *WhileStmt:
+		Walk(v, n.Cond)
+		Walk(v, n.Stmt)
+	case *WithStmt:
+		Walk(v, n.Var)
+		Walk(v, n.Stmt)
+
+	// Expressions
+	case *AtExpr:
+		Walk(v, n.Expr)
+	case *BinaryExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *ConstExpr, *IdentExpr:
+		// nothing to do
+	case *ConstArrayExpr:
+		walkExprs(v, n.Values)
+	case *ConstRecordExpr:
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+	case *ConstField:
+		Walk(v, n.Value)
+	case *DotExpr:
+		Walk(v, n.Record)
+	case *FuncExpr:
+		Walk(v, n.Func)
+		walkExprs(v, n.Args)
+	case *IndexExpr:
+		Walk(v, n.Array)
+		Walk(v, n.Index)
+	case *ParenExpr:
+		Walk(v, n.Expr)
+	case *PointerExpr:
+		Walk(v, n.Expr)
+	case *RangeExpr:
+		Walk(v, n.Min)
+		Walk(v, n.Max)
+	case *SetExpr:
+		walkExprs(v, n.Values)
+	case *TypeConvExpr:
+		Walk(v, n.Type)
+		Walk(v, n.Expr)
+	case *UnaryExpr:
+		Walk(v, n.Expr)
+	case *WidthExpr:
+		Walk(v, n.Expr)
+		Walk(v, n.Width)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkDecls(v Visitor, decls []DeclPart) {
+	for _, decl := range decls {
+		Walk(v, decl)
+	}
+}
+
+func walkParams(v Visitor, params []*ParamGroup) {
+	for _, group := range params {
+		Walk(v, group)
+	}
+}
+
+func walkStmts(v Visitor, stmts []Stmt) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+func walkExprs(v Visitor, exprs []Expr) {
+	for _, expr := range exprs {
+		Walk(v, expr)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: it starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
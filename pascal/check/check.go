@@ -0,0 +1,1396 @@
+// Package check resolves the identifiers in a Turbo Pascal AST to
+// their declarations and works out the type of every expression.
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// Info holds the results of checking a file.
+type Info struct {
+	// Types maps each expression to its type, with type names
+	// resolved to their definitions (builtin types are one of the
+	// *ast.IdentSpec values such as Integer). An identifier naming a
+	// procedure or function has its ProcSpec or FuncSpec as its type,
+	// as Pascal calls functions without arguments without parentheses.
+	// The type is nil if it's not known, for example for names
+	// declared in a unit whose source wasn't given. Expressions of a
+	// subrange type have its SubrangeSpec as their type (use
+	// Underlying to get the type of their values).
+	Types map[ast.Expr]ast.TypeSpec
+
+	// Operands maps each arithmetic operation or comparison on numbers
+	// to the type its operands are converted to before the operation
+	// (for arithmetic, that's the type of the result too).
+	Operands map[*ast.BinaryExpr]ast.TypeSpec
+
+	// Uses maps each identifier to the symbol it refers to.
+	Uses map[*ast.IdentExpr]*Symbol
+
+	// Fields maps each record field selection, and each object field
+	// or method selection, to the field's or method's symbol.
+	Fields map[*ast.DotExpr]*Symbol
+
+	// TypeNames maps each type identifier to the type it names.
+	TypeNames map[*ast.TypeIdent]*Symbol
+
+	// Scopes maps each Program, Unit, ProcDecl, FuncDecl (with a
+	// body), and WithStmt to the scope it opens.
+	Scopes map[ast.Node]*Scope
+
+	// Subranges maps each subrange type to its bounds. Subranges
+	// whose bounds aren't constant aren't included.
+	Subranges map[*ast.SubrangeSpec]*Subrange
+
+	// Objects maps each object type to the symbol of the type name
+	// it's declared as.
+	Objects map[*ast.ObjectSpec]*Symbol
+
+	// Forwards maps each procedure or function definition to its
+	// earlier declaration, if it was declared "forward" or in the
+	// interface of the unit. The definition's parameters and result
+	// type may be omitted, in which case they're the declaration's.
+	Forwards map[ast.DeclPart]ast.DeclPart
+
+	// Results maps each identifier that refers to the result variable
+	// of a function to the function's FuncDecl: the function's name
+	// as the target of an assignment in its body (elsewhere it's a
+	// call), and Delphi's Result variable (see Options.ResultVar).
+	// The identifier's type is the function's result type.
+	Results map[*ast.IdentExpr]*ast.FuncDecl
+}
+
+// Options are the optional settings for Check.
+type Options struct {
+	// If true, declare Delphi's implicit Result variable in every
+	// function, which holds the function's result like its name.
+	ResultVar bool
+}
+
+// Subrange holds the bounds of a subrange type.
+type Subrange struct {
+	// Ordinal values of the lower and upper bounds
+	Min, Max int
+	// Type the subrange is a range of: the smallest integer type that
+	// holds Min to Max, Char, Boolean, or an enumerated type's
+	// *ast.ScalarSpec
+	Base ast.TypeSpec
+}
+
+// Resolve follows the type names in spec to the type's definition.
+// Builtin types are returned as is, and nil is returned if a type
+// name isn't declared.
+func (info *Info) Resolve(spec ast.TypeSpec) ast.TypeSpec {
+	for i := 0; i < maxResolveDepth; i++ {
+		ident, isIdent := spec.(*ast.IdentSpec)
+		if !isIdent {
+			return spec
+		}
+		sym := info.TypeNames[ident.Type]
+		if sym == nil || sym.Kind != SymType {
+			return nil
+		}
+		if sym.Type == ast.TypeSpec(ident) {
+			return ident // builtin type
+		}
+		spec = sym.Type
+	}
+	return nil // type defined in terms of itself
+}
+
+const maxResolveDepth = 100
+
+// Parent returns the parent type of an object type, or nil if it
+// doesn't have one (or it isn't an object type).
+func (info *Info) Parent(object *ast.ObjectSpec) *ast.ObjectSpec {
+	if object.Parent == nil {
+		return nil
+	}
+	parent, _ := info.Resolve(&ast.IdentSpec{Type: object.Parent}).(*ast.ObjectSpec)
+	return parent
+}
+
+// Underlying returns the base type of a subrange type (see
+// Subrange.Base), which is what its values are operated on as, or
+// typ itself if it's not a subrange type. It returns nil for a
+// subrange whose bounds aren't known.
+func (info *Info) Underlying(typ ast.TypeSpec) ast.TypeSpec {
+	spec, isSubrange := typ.(*ast.SubrangeSpec)
+	if !isSubrange {
+		return typ
+	}
+	if sub := info.Subranges[spec]; sub != nil {
+		return sub.Base
+	}
+	return nil
+}
+
+// IntValue returns the value of an integer constant expression, if
+// it's simple enough to work out.
+func (info *Info) IntValue(expr ast.Expr) (int, bool) {
+	switch expr := expr.(type) {
+	case *ast.ConstExpr:
+		value, isInt := expr.Value.(int)
+		return value, isInt
+	case *ast.IdentExpr:
+		sym := info.Uses[expr]
+		if sym == nil || sym.Kind != SymConst {
+			return 0, false
+		}
+		decl, isConstDecl := sym.Decl.(*ast.ConstDecl)
+		if !isConstDecl || decl.Type != nil {
+			return 0, false
+		}
+		return info.IntValue(decl.Value)
+	case *ast.ParenExpr:
+		return info.IntValue(expr.Expr)
+	case *ast.UnaryExpr:
+		value, ok := info.IntValue(expr.Expr)
+		if ok && expr.Op == token.MINUS {
+			value = -value
+		}
+		return value, ok && (expr.Op == token.MINUS || expr.Op == token.PLUS)
+	}
+	return 0, false
+}
+
+// Bounds returns the lowest and highest ordinal values of an ordinal
+// type, for example 0 and 255 for Char, or 1 and 60 for 1..60. It
+// returns false if typ isn't an ordinal type with known bounds.
+func (info *Info) Bounds(typ ast.TypeSpec) (min, max int, ok bool) {
+	typ = info.Resolve(typ)
+	switch spec := typ.(type) {
+	case *ast.SubrangeSpec:
+		sub := info.Subranges[spec]
+		if sub == nil {
+			return 0, 0, false
+		}
+		return sub.Min, sub.Max, true
+	case *ast.ScalarSpec:
+		return 0, len(spec.Names) - 1, true
+	}
+	switch typ {
+	case Boolean:
+		return 0, 1, true
+	case Char:
+		return 0, 255, true
+	}
+	for _, t := range intTypes {
+		if typ == ast.TypeSpec(t.typ) {
+			return t.min, t.max, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Error (actually *Error) is the type of a single check error; Check
+// returns a list of these as an ErrorList.
+type Error struct {
+	// Source line/column position where the error occurred.
+	Position token.Position
+	// Error message.
+	Message string
+}
+
+// Error returns a formatted version of the error, including the line
+// and column numbers.
+func (e *Error) Error() string {
+	if e.Position.Filename != "" {
+		return fmt.Sprintf("check error at %s:%d:%d: %s",
+			e.Position.Filename, e.Position.Line, e.Position.Column, e.Message)
+	}
+	return fmt.Sprintf("check error at %d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+}
+
+// ErrorList is the type of error returned by Check: a list of all
+// the errors found in the source, in the order they were found.
+type ErrorList []*Error
+
+// Error returns all the errors formatted one per line.
+func (e ErrorList) Error() string {
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// Check resolves the identifiers in the given program or unit and
+// works out the types of its expressions. Units it uses are looked up
+// in units by name; names from units that aren't given are reported
+// as undeclared. If there are errors, Check returns them as an
+// ErrorList, along with the Info for everything it could resolve.
+func Check(file ast.File, units []*ast.Unit, options Options) (*Info, error) {
+	c := &checker{
+		options: options,
+		info: &Info{
+			Types:     make(map[ast.Expr]ast.TypeSpec),
+			Operands:  make(map[*ast.BinaryExpr]ast.TypeSpec),
+			Uses:      make(map[*ast.IdentExpr]*Symbol),
+			Fields:    make(map[*ast.DotExpr]*Symbol),
+			TypeNames: make(map[*ast.TypeIdent]*Symbol),
+			Scopes:    make(map[ast.Node]*Scope),
+			Subranges: make(map[*ast.SubrangeSpec]*Subrange),
+			Objects:   make(map[*ast.ObjectSpec]*Symbol),
+			Forwards:  make(map[ast.DeclPart]ast.DeclPart),
+			Results:   make(map[*ast.IdentExpr]*ast.FuncDecl),
+		},
+		units:      make(map[string]*ast.Unit),
+		unitScopes: make(map[string]*Scope),
+		records:    make(map[*ast.RecordSpec]map[string]*Symbol),
+		objects:    make(map[*ast.ObjectSpec]map[string]*Symbol),
+	}
+	for _, unit := range units {
+		c.units[strings.ToLower(unit.Name)] = unit
+	}
+	c.universeScope = c.universe()
+
+	switch file := file.(type) {
+	case *ast.Program:
+		c.program(file)
+	case *ast.Unit:
+		c.unit(file)
+	default:
+		panic(fmt.Sprintf("unhandled File type: %T", file))
+	}
+
+	if len(c.errors) > 0 {
+		return c.info, c.errors
+	}
+	return c.info, nil
+}
+
+// Checker state
+type checker struct {
+	options Options
+	info    *Info
+	errors  ErrorList
+
+	// Units available by lowercase name, and the scopes holding their
+	// interface declarations once they've been checked
+	units      map[string]*ast.Unit
+	unitScopes map[string]*Scope
+
+	universeScope *Scope
+	scope         *Scope // current scope
+	unitName      string // unit being checked, or "" for a program
+
+	// Field symbols of each record type, and field and method symbols
+	// of each object type, keyed by lowercase name
+	records map[*ast.RecordSpec]map[string]*Symbol
+	objects map[*ast.ObjectSpec]map[string]*Symbol
+}
+
+func (c *checker) errorf(pos token.Position, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.errors = append(c.errors, &Error{Position: pos, Message: message})
+}
+
+func (c *checker) openScope(kind ScopeKind, node ast.Node) {
+	c.scope = newScope(kind, c.scope, node)
+	c.info.Scopes[node] = c.scope
+}
+
+func (c *checker) closeScope() {
+	c.scope = c.scope.Parent
+}
+
+func (c *checker) declare(name string, kind SymbolKind, typ ast.TypeSpec, decl ast.Node) *Symbol {
+	sym := &Symbol{
+		Name:  name,
+		Kind:  kind,
+		Type:  typ,
+		Decl:  decl,
+		Scope: c.scope,
+		Unit:  c.unitName,
+	}
+	c.scope.Symbols[strings.ToLower(name)] = sym
+	return sym
+}
+
+func (c *checker) program(program *ast.Program) {
+	c.scope = c.usesScope(program.Uses)
+	c.openScope(ScopeGlobal, program)
+	c.decls(program.Decls)
+	c.stmt(program.Stmt)
+}
+
+func (c *checker) unit(unit *ast.Unit) {
+	c.unitName = unit.Name
+	uses := c.usesScope(unit.InterfaceUses)
+	c.scope = uses
+	c.openScope(ScopeGlobal, unit)
+	c.decls(unit.Interface)
+	c.addUses(uses, unit.ImplementationUses)
+	c.decls(unit.Implementation)
+	c.stmt(unit.Init)
+}
+
+// usesScope returns a new scope (in the universe) with the interface
+// declarations of the given units.
+func (c *checker) usesScope(unitNames []string) *Scope {
+	scope := newScope(ScopeUses, c.universeScope, nil)
+	c.addUses(scope, unitNames)
+	return scope
+}
+
+// addUses adds the interface declarations of the given units to a
+// uses scope. Units later in the list hide names from earlier ones.
+func (c *checker) addUses(scope *Scope, unitNames []string) {
+	for _, name := range unitNames {
+		unitScope := c.unitScope(name)
+		if unitScope == nil {
+			continue
+		}
+		for key, sym := range unitScope.Symbols {
+			scope.Symbols[key] = sym
+		}
+	}
+}
+
+// unitScope returns the scope with the interface declarations of the
+// named unit, checking them the first time it's called. It returns
+// nil if the unit's source wasn't given.
+func (c *checker) unitScope(name string) *Scope {
+	key := strings.ToLower(name)
+	if scope, checked := c.unitScopes[key]; checked {
+		return scope
+	}
+	unit := c.units[key]
+	if unit == nil {
+		c.unitScopes[key] = nil
+		return nil
+	}
+	c.unitScopes[key] = nil // in case of a circular reference
+
+	savedScope, savedUnitName := c.scope, c.unitName
+	c.unitName = unit.Name
+	c.scope = c.usesScope(unit.InterfaceUses)
+	c.openScope(ScopeGlobal, unit)
+	c.decls(unit.Interface)
+	scope := c.scope
+	c.scope, c.unitName = savedScope, savedUnitName
+
+	c.unitScopes[key] = scope
+	return scope
+}
+
+func (c *checker) decls(decls []ast.DeclPart) {
+	for _, decl := range decls {
+		c.decl(decl)
+	}
+	c.checkForwards(decls)
+}
+
+func (c *checker) decl(decl ast.DeclPart) {
+	switch decl := decl.(type) {
+	case *ast.ConstDecls:
+		for _, d := range decl.Decls {
+			typ := d.Type
+			if typ != nil {
+				c.typeSpec(typ)
+				c.constValue(d.Value, c.info.Resolve(typ))
+			} else {
+				typ = c.expr(d.Value)
+			}
+			c.declare(d.Name, SymConst, typ, d)
+		}
+	case *ast.FuncDecl:
+		c.params(decl.Params)
+		if decl.Result != nil {
+			c.typeIdent(decl.Result)
+		}
+		if decl.Object != nil {
+			c.method(decl, decl.Object, decl.Name, decl.Params, decl.Decls, decl.Stmt)
+			break
+		}
+		params, result := decl.Params, decl.Result
+		if forward, isFunc := c.forward(decl, decl.Name).(*ast.FuncDecl); isFunc {
+			params, result = forward.Params, forward.Result
+		} else if result == nil {
+			c.errorf(decl.Pos(), "function %s must have a result type", decl.Name)
+		}
+		spec := &ast.FuncSpec{Params: params, Result: result, Span: decl.Span}
+		c.declare(decl.Name, SymFunc, spec, decl)
+		if decl.Stmt != nil {
+			c.block(decl, params, decl.Decls, decl.Stmt)
+		}
+	case *ast.LabelDecls:
+		// nothing to do
+	case *ast.ProcDecl:
+		c.params(decl.Params)
+		if decl.Object != nil {
+			c.method(decl, decl.Object, decl.Name, decl.Params, decl.Decls, decl.Stmt)
+			break
+		}
+		params := decl.Params
+		if forward, isProc := c.forward(decl, decl.Name).(*ast.ProcDecl); isProc {
+			params = forward.Params
+		}
+		spec := &ast.ProcSpec{Params: params, Span: decl.Span}
+		c.declare(decl.Name, SymProc, spec, decl)
+		if decl.Stmt != nil {
+			c.block(decl, params, decl.Decls, decl.Stmt)
+		}
+	case *ast.TypeDefs:
+		// Declare all the names first, so that pointer types can
+		// refer to types defined later in the same section.
+		for _, d := range decl.Defs {
+			sym := c.declare(d.Name, SymType, d.Type, d)
+			if object, isObject := d.Type.(*ast.ObjectSpec); isObject {
+				c.info.Objects[object] = sym
+			}
+		}
+		for _, d := range decl.Defs {
+			c.typeSpec(d.Type)
+		}
+	case *ast.VarDecls:
+		for _, d := range decl.Decls {
+			c.typeSpec(d.Type)
+			for _, name := range d.Names {
+				c.declare(name, SymVar, d.Type, d)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unhandled DeclPart type: %T", decl))
+	}
+}
+
+// forward returns the earlier declaration of the procedure or function
+// that decl defines, or nil if it wasn't declared "forward" (or in the
+// unit's interface) in the current scope. If the definition repeats
+// the parameters and result type, they must match the declaration's.
+func (c *checker) forward(decl ast.DeclPart, name string) ast.DeclPart {
+	sym := c.scope.Symbols[strings.ToLower(name)]
+	if sym == nil {
+		return nil
+	}
+	var forward ast.DeclPart
+	matches := true
+	switch decl := decl.(type) {
+	case *ast.ProcDecl:
+		prev, isProc := sym.Decl.(*ast.ProcDecl)
+		if decl.Stmt == nil || !isProc || prev.Stmt != nil || prev.External || prev.Inline != nil {
+			return nil
+		}
+		forward = prev
+		if decl.Params != nil {
+			matches = sameParams(decl.Params, prev.Params)
+		}
+	case *ast.FuncDecl:
+		prev, isFunc := sym.Decl.(*ast.FuncDecl)
+		if decl.Stmt == nil || !isFunc || prev.Stmt != nil || prev.External || prev.Inline != nil {
+			return nil
+		}
+		forward = prev
+		if decl.Params != nil || decl.Result != nil {
+			matches = sameParams(decl.Params, prev.Params) && sameTypeName(decl.Result, prev.Result)
+		}
+	}
+	if !matches {
+		c.errorf(decl.Pos(), "%s doesn't match its earlier declaration", name)
+	}
+	c.info.Forwards[decl] = forward
+	return forward
+}
+
+// sameParams reports whether two parameter lists declare the same
+// parameters, however they're grouped.
+func sameParams(params1, params2 []*ast.ParamGroup) bool {
+	type param struct {
+		name  string
+		isVar bool
+		typ   *ast.TypeIdent
+	}
+	flatten := func(params []*ast.ParamGroup) []param {
+		var flat []param
+		for _, group := range params {
+			for _, name := range group.Names {
+				flat = append(flat, param{name, group.IsVar, group.Type})
+			}
+		}
+		return flat
+	}
+	flat1, flat2 := flatten(params1), flatten(params2)
+	if len(flat1) != len(flat2) {
+		return false
+	}
+	for i := range flat1 {
+		if !strings.EqualFold(flat1[i].name, flat2[i].name) || flat1[i].isVar != flat2[i].isVar ||
+			!sameTypeName(flat1[i].typ, flat2[i].typ) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTypeName(typ1, typ2 *ast.TypeIdent) bool {
+	if typ1 == nil || typ2 == nil {
+		return typ1 == typ2
+	}
+	return strings.EqualFold(typ1.Name, typ2.Name)
+}
+
+// checkForwards reports the "forward" declarations in decls that
+// weren't followed by a definition in the same scope.
+func (c *checker) checkForwards(decls []ast.DeclPart) {
+	for _, decl := range decls {
+		var name string
+		switch decl := decl.(type) {
+		case *ast.ProcDecl:
+			if !decl.Forward {
+				continue
+			}
+			name = decl.Name
+		case *ast.FuncDecl:
+			if !decl.Forward {
+				continue
+			}
+			name = decl.Name
+		default:
+			continue
+		}
+		if sym := c.scope.Symbols[strings.ToLower(name)]; sym != nil && sym.Decl == decl {
+			c.errorf(decl.Pos(), "forward declaration of %s has no definition", name)
+		}
+	}
+}
+
+// block checks the body of a procedure or function in a new scope.
+func (c *checker) block(decl ast.Node, params []*ast.ParamGroup, decls []ast.DeclPart, stmt *ast.CompoundStmt) {
+	var result *ast.TypeIdent
+	if fn, isFunc := decl.(*ast.FuncDecl); isFunc && c.options.ResultVar {
+		// The function (or method) is declared in the enclosing scope
+		if sym := c.scope.Symbols[strings.ToLower(fn.Name)]; sym != nil {
+			if spec, isFunc := sym.Type.(*ast.FuncSpec); isFunc {
+				result = spec.Result
+			}
+		}
+	}
+	c.openScope(ScopeLocal, decl)
+	if result != nil {
+		c.declare("Result", SymVar, &ast.IdentSpec{Type: result, Span: result.Span}, decl)
+	}
+	for _, group := range params {
+		kind := SymParam
+		if group.IsVar {
+			kind = SymVarParam
+		}
+		for _, name := range group.Names {
+			c.declare(name, kind, &ast.IdentSpec{Type: group.Type, Span: group.Type.Span}, group)
+		}
+	}
+	c.decls(decls)
+	c.stmt(stmt)
+	c.closeScope()
+}
+
+// method checks the implementation of an object type's method. The
+// object's fields and methods (including inherited ones) and Self are
+// in scope in its body, between the global scope and its own.
+func (c *checker) method(decl ast.Node, objType *ast.TypeIdent, name string, params []*ast.ParamGroup, decls []ast.DeclPart, stmt *ast.CompoundStmt) {
+	if c.scope.Kind != ScopeGlobal {
+		c.errorf(decl.Pos(), "method %s.%s must be declared at the top level", objType.Name, name)
+	}
+	c.typeIdent(objType)
+	object, isObject := c.info.Resolve(&ast.IdentSpec{Type: objType}).(*ast.ObjectSpec)
+	if !isObject {
+		c.errorf(objType.Pos(), "%s is not an object type", objType.Name)
+		return
+	}
+	if OwnMethod(object, name) == nil {
+		c.errorf(decl.Pos(), "object type %s has no method %q", objType.Name, name)
+	}
+	if stmt == nil {
+		return
+	}
+	c.objectScope(object)
+	c.declare("Self", SymVarParam, &ast.IdentSpec{Type: objType, Span: objType.Span}, decl)
+	c.block(decl, params, decls, stmt)
+	c.closeScope()
+}
+
+// objectScope opens a scope with the fields and methods of an object
+// type, for the body of one of its methods (or the constructor or
+// destructor call in a New or Dispose).
+func (c *checker) objectScope(object *ast.ObjectSpec) {
+	c.scope = newScope(ScopeObject, c.scope, object)
+	for key, member := range c.members(object) {
+		objectMember := *member
+		objectMember.Scope = c.scope
+		c.scope.Symbols[key] = &objectMember
+	}
+}
+
+func (c *checker) params(params []*ast.ParamGroup) {
+	for _, group := range params {
+		c.typeIdent(group.Type)
+	}
+}
+
+// constValue checks the value of a typed constant. Array and record
+// constants get their type from the declaration.
+func (c *checker) constValue(value ast.Expr, typ ast.TypeSpec) {
+	switch value := value.(type) {
+	case *ast.ConstArrayExpr:
+		c.info.Types[value] = typ
+		var elemType ast.TypeSpec
+		if array, isArray := typ.(*ast.ArraySpec); isArray {
+			elemType = c.info.Resolve(array.Of)
+		}
+		for _, v := range value.Values {
+			c.constValue(v, elemType)
+		}
+	case *ast.ConstRecordExpr:
+		c.info.Types[value] = typ
+		record, _ := typ.(*ast.RecordSpec)
+		for _, f := range value.Fields {
+			var fieldType ast.TypeSpec
+			if record != nil {
+				field := c.fields(record)[strings.ToLower(f.Name)]
+				if field == nil {
+					c.errorf(f.Pos(), "record has no field %q", f.Name)
+				} else {
+					fieldType = c.info.Resolve(field.Type)
+				}
+			}
+			c.constValue(f.Value, fieldType)
+		}
+	default:
+		c.expr(value)
+	}
+}
+
+// typeSpec resolves the type names in a type specification and
+// declares the values of any enumerated types in it.
+func (c *checker) typeSpec(spec ast.TypeSpec) {
+	switch spec := spec.(type) {
+	case *ast.FuncSpec:
+		c.params(spec.Params)
+		c.typeIdent(spec.Result)
+	case *ast.ProcSpec:
+		c.params(spec.Params)
+	case *ast.ScalarSpec:
+		for _, name := range spec.Names {
+			c.declare(name, SymConst, spec, spec)
+		}
+	case *ast.IdentSpec:
+		c.typeIdent(spec.Type)
+	case *ast.StringSpec:
+		// nothing to do
+	case *ast.ArraySpec:
+		if spec.Index != nil {
+			c.typeSpec(spec.Index)
+			if _, _, ok := c.info.Bounds(spec.Index); !ok {
+				c.errorf(spec.Index.Pos(), "array index must be an ordinal type")
+			}
+		} else {
+			c.expr(spec.Min)
+			c.expr(spec.Max)
+		}
+		c.typeSpec(spec.Of)
+	case *ast.RecordSpec:
+		c.recordTypes(spec.Sections, spec.Variant)
+		c.records[spec] = recordFields(spec, c.unitName)
+	case *ast.FileSpec:
+		if spec.Of != nil {
+			c.typeSpec(spec.Of)
+		}
+	case *ast.PointerSpec:
+		c.typeIdent(spec.Type)
+	case *ast.SetSpec:
+		c.typeSpec(spec.Of)
+	case *ast.SubrangeSpec:
+		c.subrange(spec)
+	case *ast.ObjectSpec:
+		if c.info.Objects[spec] == nil {
+			c.errorf(spec.Pos(), "object type must be declared in a type definition")
+		}
+		if spec.Parent != nil {
+			c.typeIdent(spec.Parent)
+			if c.info.Parent(spec) == nil {
+				c.errorf(spec.Parent.Pos(), "%s is not an object type", spec.Parent.Name)
+			}
+		}
+		c.recordTypes(spec.Sections, nil)
+		for _, method := range spec.Methods {
+			switch method := method.(type) {
+			case *ast.ProcDecl:
+				c.params(method.Params)
+			case *ast.FuncDecl:
+				c.params(method.Params)
+				c.typeIdent(method.Result)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unhandled TypeSpec type: %T", spec))
+	}
+}
+
+// subrange works out the bounds and base type of a subrange type.
+func (c *checker) subrange(spec *ast.SubrangeSpec) {
+	c.expr(spec.Min)
+	c.expr(spec.Max)
+	min, base, minOK := c.ordValue(spec.Min)
+	max, _, maxOK := c.ordValue(spec.Max)
+	if !minOK || !maxOK {
+		c.errorf(spec.Pos(), "subrange bounds must be ordinal constants")
+		return
+	}
+	if min > max {
+		c.errorf(spec.Pos(), "subrange lower bound is greater than upper bound")
+		return
+	}
+	if base == nil {
+		// Integer subrange: use the smallest type that holds it
+		base = Longint
+		for _, t := range intTypes {
+			if min >= t.min && max <= t.max {
+				base = t.typ
+				break
+			}
+		}
+	}
+	c.info.Subranges[spec] = &Subrange{Min: min, Max: max, Base: base}
+}
+
+func (c *checker) typeIdent(ident *ast.TypeIdent) {
+	sym := c.scope.Lookup(ident.Name)
+	if sym == nil || sym.Kind != SymType {
+		c.errorf(ident.Pos(), "undeclared type %q", ident.Name)
+		return
+	}
+	c.info.TypeNames[ident] = sym
+}
+
+// recordTypes checks the field types of a record, and the tag types
+// and case constants of its variant part.
+func (c *checker) recordTypes(sections []*ast.RecordSection, variant *ast.RecordVariant) {
+	for _, section := range sections {
+		c.typeSpec(section.Type)
+	}
+	if variant == nil {
+		return
+	}
+	c.typeIdent(variant.Type)
+	for _, cas := range variant.Cases {
+		c.exprs(cas.Consts)
+		c.recordTypes(cas.Sections, cas.Variant)
+	}
+}
+
+// fields returns the field symbols of the given record type.
+func (c *checker) fields(record *ast.RecordSpec) map[string]*Symbol {
+	fields := c.records[record]
+	if fields == nil {
+		// Record type from outside the checked declarations
+		fields = recordFields(record, "")
+		c.records[record] = fields
+	}
+	return fields
+}
+
+// recordFields returns the field symbols of a record type, keyed by
+// lowercase name, including the tag and fields of its variant part.
+func recordFields(record *ast.RecordSpec, unit string) map[string]*Symbol {
+	fields := make(map[string]*Symbol)
+	var add func(sections []*ast.RecordSection, variant *ast.RecordVariant)
+	add = func(sections []*ast.RecordSection, variant *ast.RecordVariant) {
+		for _, section := range sections {
+			for _, name := range section.Names {
+				fields[strings.ToLower(name)] = &Symbol{Name: name, Kind: SymField, Type: section.Type, Decl: section, Unit: unit}
+			}
+		}
+		if variant == nil {
+			return
+		}
+		if variant.Tag != "" {
+			typ := &ast.IdentSpec{Type: variant.Type, Span: variant.Type.Span}
+			fields[strings.ToLower(variant.Tag)] = &Symbol{Name: variant.Tag, Kind: SymField, Type: typ, Decl: variant, Unit: unit}
+		}
+		for _, cas := range variant.Cases {
+			add(cas.Sections, cas.Variant)
+		}
+	}
+	add(record.Sections, record.Variant)
+	return fields
+}
+
+// members returns the field and method symbols of an object type,
+// including those it inherits, keyed by lowercase name.
+func (c *checker) members(object *ast.ObjectSpec) map[string]*Symbol {
+	if members := c.objects[object]; members != nil {
+		return members
+	}
+	members := make(map[string]*Symbol)
+	c.objects[object] = members // in case of a circular reference
+	if parent := c.info.Parent(object); parent != nil {
+		for key, sym := range c.members(parent) {
+			members[key] = sym
+		}
+	}
+	unit := ""
+	if sym := c.info.Objects[object]; sym != nil {
+		unit = sym.Unit
+	}
+	for _, section := range object.Sections {
+		for _, name := range section.Names {
+			members[strings.ToLower(name)] = &Symbol{Name: name, Kind: SymField, Type: section.Type, Decl: section, Unit: unit}
+		}
+	}
+	for _, method := range object.Methods {
+		var sym *Symbol
+		switch method := method.(type) {
+		case *ast.ProcDecl:
+			spec := &ast.ProcSpec{Params: method.Params, Span: method.Span}
+			sym = &Symbol{Name: method.Name, Kind: SymProc, Type: spec, Decl: method, Unit: unit}
+		case *ast.FuncDecl:
+			spec := &ast.FuncSpec{Params: method.Params, Result: method.Result, Span: method.Span}
+			sym = &Symbol{Name: method.Name, Kind: SymFunc, Type: spec, Decl: method, Unit: unit}
+		}
+		members[strings.ToLower(sym.Name)] = sym
+	}
+	return members
+}
+
+// OwnMethod returns the heading of the named method declared by an
+// object type itself (not inherited), or nil if there isn't one.
+func OwnMethod(object *ast.ObjectSpec, name string) ast.DeclPart {
+	for _, method := range object.Methods {
+		switch method := method.(type) {
+		case *ast.ProcDecl:
+			if strings.EqualFold(method.Name, name) {
+				return method
+			}
+		case *ast.FuncDecl:
+			if strings.EqualFold(method.Name, name) {
+				return method
+			}
+		}
+	}
+	return nil
+}
+
+func (c *checker) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+func (c *checker) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if stmt.TypeConv != nil {
+			c.typeIdent(stmt.TypeConv)
+		}
+		c.assignTarget(stmt.Var)
+		c.expr(stmt.Value)
+	case *ast.CaseStmt:
+		c.expr(stmt.Selector)
+		for _, cas := range stmt.Cases {
+			c.exprs(cas.Consts)
+			c.stmt(cas.Stmt)
+		}
+		c.stmts(stmt.Else)
+	case *ast.CompoundStmt:
+		c.stmts(stmt.Stmts)
+	case *ast.EmptyStmt, *ast.GotoStmt:
+		// nothing to do
+	case *ast.ForStmt:
+		c.expr(stmt.Var)
+		c.expr(stmt.Initial)
+		c.expr(stmt.Final)
+		c.stmt(stmt.Stmt)
+	case *ast.IfStmt:
+		c.expr(stmt.Cond)
+		c.stmt(stmt.Then)
+		if stmt.Else != nil {
+			c.stmt(stmt.Else)
+		}
+	case *ast.LabelledStmt:
+		c.stmt(stmt.Stmt)
+	case *ast.ProcStmt:
+		c.expr(stmt.Proc)
+		if !c.objectAlloc(stmt.Proc, stmt.Args) {
+			c.exprs(stmt.Args)
+		}
+	case *ast.RepeatStmt:
+		c.stmts(stmt.Stmts)
+		c.expr(stmt.Cond)
+	case *ast.WhileStmt:
+		c.expr(stmt.Cond)
+		c.stmt(stmt.Stmt)
+	case *ast.WithStmt:
+		typ := c.expr(stmt.Var)
+		c.openScope(ScopeWith, stmt)
+		var fields map[string]*Symbol
+		switch typ := typ.(type) {
+		case *ast.RecordSpec:
+			fields = c.fields(typ)
+		case *ast.ObjectSpec:
+			fields = c.members(typ)
+		}
+		if fields != nil {
+			for key, field := range fields {
+				withField := *field
+				withField.Scope = c.scope
+				c.scope.Symbols[key] = &withField
+			}
+		} else if typ != nil {
+			c.errorf(stmt.Var.Pos(), "'with' requires a record, not %s", typ)
+		}
+		c.stmt(stmt.Stmt)
+		c.closeScope()
+	default:
+		panic(fmt.Sprintf("unhandled Stmt type: %T", stmt))
+	}
+}
+
+// objectAlloc checks the arguments of a call to New or Dispose with
+// a constructor or destructor call as the second argument, like
+// New(p, Init(1, 2)), which calls a method of p's object type. It
+// returns false if it's not such a call.
+func (c *checker) objectAlloc(proc ast.Expr, args []ast.Expr) bool {
+	ident, isIdent := proc.(*ast.IdentExpr)
+	if !isIdent || len(args) != 2 {
+		return false
+	}
+	var kind ast.ProcKind
+	switch sym := c.info.Uses[ident]; {
+	case sym == nil || sym.Kind != SymBuiltin:
+		return false
+	case strings.EqualFold(sym.Name, "New"):
+		kind = ast.Constructor
+	case strings.EqualFold(sym.Name, "Dispose"):
+		kind = ast.Destructor
+	default:
+		return false
+	}
+	var object *ast.ObjectSpec
+	if pointer, isPointer := c.expr(args[0]).(*ast.PointerSpec); isPointer {
+		object, _ = c.info.Resolve(&ast.IdentSpec{Type: pointer.Type}).(*ast.ObjectSpec)
+	}
+	if object == nil {
+		c.errorf(args[0].Pos(), "%s with two arguments requires a pointer to an object", ident.Name)
+		c.expr(args[1])
+		return true
+	}
+	c.objectScope(object)
+	c.expr(args[1])
+	c.closeScope()
+	call := args[1]
+	if funcExpr, isFunc := call.(*ast.FuncExpr); isFunc {
+		call = funcExpr.Func
+	}
+	if name, isIdent := call.(*ast.IdentExpr); isIdent {
+		if sym := c.info.Uses[name]; sym != nil {
+			if decl, isProc := sym.Decl.(*ast.ProcDecl); isProc && decl.Kind == kind {
+				return true
+			}
+		}
+	}
+	c.errorf(args[1].Pos(), "%s requires a %s call as its second argument", ident.Name, kind)
+	return true
+}
+
+// assignTarget checks the target of an assignment. In the body of a
+// function (or of a procedure nested in it), the function's name as
+// the target is its result variable rather than a call.
+func (c *checker) assignTarget(expr ast.Expr) {
+	ident, isIdent := expr.(*ast.IdentExpr)
+	if !isIdent {
+		c.expr(expr)
+		return
+	}
+	sym := c.scope.Lookup(ident.Name)
+	if sym == nil || sym.Kind != SymFunc {
+		c.expr(expr)
+		return
+	}
+	spec, isFunc := sym.Type.(*ast.FuncSpec)
+	if !isFunc {
+		c.expr(expr)
+		return
+	}
+	for scope := c.scope; scope != nil; scope = scope.Parent {
+		fn, isFunc := scope.Node.(*ast.FuncDecl)
+		if !isFunc || scope.Kind != ScopeLocal || !strings.EqualFold(fn.Name, sym.Name) {
+			continue
+		}
+		// Same name, but is it the same function (or method)?
+		if sym.Decl == ast.Node(fn) || (fn.Object != nil && sym.Scope != nil && sym.Scope == scope.Parent) {
+			c.info.Uses[ident] = sym
+			c.info.Results[ident] = fn
+			c.info.Types[ident] = c.info.Resolve(&ast.IdentSpec{Type: spec.Result})
+			return
+		}
+	}
+	c.expr(expr)
+}
+
+func (c *checker) exprs(exprs []ast.Expr) {
+	for _, expr := range exprs {
+		c.expr(expr)
+	}
+}
+
+// expr checks an expression, records its type in Info.Types, and
+// returns the type.
+func (c *checker) expr(expr ast.Expr) ast.TypeSpec {
+	typ := c.info.Resolve(c.exprType(expr))
+	c.info.Types[expr] = typ
+	return typ
+}
+
+func (c *checker) exprType(expr ast.Expr) ast.TypeSpec {
+	switch expr := expr.(type) {
+	case *ast.AtExpr:
+		c.expr(expr.Expr)
+		return Pointer
+	case *ast.BinaryExpr:
+		left := c.expr(expr.Left)
+		right := c.expr(expr.Right)
+		return c.binaryType(expr, left, right)
+	case *ast.ConstExpr:
+		switch value := expr.Value.(type) {
+		case bool:
+			return Boolean
+		case int:
+			return UntypedInt
+		case float64:
+			return Real
+		case string:
+			if len(value) == 1 {
+				return Char
+			}
+			return String
+		default: // nil
+			return Pointer
+		}
+	case *ast.ConstArrayExpr:
+		c.exprs(expr.Values) // type only known from declaration
+		return nil
+	case *ast.ConstRecordExpr:
+		for _, f := range expr.Fields {
+			c.expr(f.Value)
+		}
+		return nil
+	case *ast.DotExpr:
+		typ := c.expr(expr.Record)
+		if object, isObject := typ.(*ast.ObjectSpec); isObject {
+			member := c.members(object)[strings.ToLower(expr.Field)]
+			if member == nil {
+				c.errorf(expr.Pos(), "object has no field or method %q", expr.Field)
+				return nil
+			}
+			c.info.Fields[expr] = member
+			return member.Type
+		}
+		record, isRecord := typ.(*ast.RecordSpec)
+		if !isRecord {
+			if typ != nil {
+				c.errorf(expr.Pos(), "%s is not a record", expr.Record)
+			}
+			return nil
+		}
+		field := c.fields(record)[strings.ToLower(expr.Field)]
+		if field == nil {
+			c.errorf(expr.Pos(), "record has no field %q", expr.Field)
+			return nil
+		}
+		c.info.Fields[expr] = field
+		return field.Type
+	case *ast.FuncExpr:
+		typ := c.expr(expr.Func)
+		if c.objectAlloc(expr.Func, expr.Args) {
+			// New(PType, Constructor) returns the new PType
+			return c.info.Types[expr.Args[0]]
+		}
+		c.exprs(expr.Args)
+		if funcSpec, isFunc := typ.(*ast.FuncSpec); isFunc {
+			return &ast.IdentSpec{Type: funcSpec.Result}
+		}
+		// A type name called like a function is a type cast
+		if ident, isIdent := expr.Func.(*ast.IdentExpr); isIdent {
+			if sym := c.info.Uses[ident]; sym != nil && sym.Kind == SymType {
+				return typ
+			}
+		}
+		return nil
+	case *ast.IdentExpr:
+		sym := c.scope.Lookup(expr.Name)
+		if sym == nil {
+			c.errorf(expr.Pos(), "undeclared name %q", expr.Name)
+			return nil
+		}
+		c.info.Uses[expr] = sym
+		if fn, isFunc := sym.Decl.(*ast.FuncDecl); isFunc && sym.Kind == SymVar {
+			c.info.Results[expr] = fn // Delphi's Result
+		}
+		return sym.Type
+	case *ast.IndexExpr:
+		typ := c.expr(expr.Array)
+		c.expr(expr.Index)
+		switch typ := typ.(type) {
+		case *ast.ArraySpec:
+			return typ.Of
+		case *ast.StringSpec:
+			return Char
+		case *ast.IdentSpec:
+			if typ == String {
+				return Char
+			}
+		case nil:
+			return nil
+		}
+		c.errorf(expr.Pos(), "%s is not an array or string", expr.Array)
+		return nil
+	case *ast.ParenExpr:
+		return c.expr(expr.Expr)
+	case *ast.PointerExpr:
+		typ := c.expr(expr.Expr)
+		if pointer, isPointer := typ.(*ast.PointerSpec); isPointer {
+			return &ast.IdentSpec{Type: pointer.Type}
+		}
+		return nil // untyped Pointer, or unknown
+	case *ast.RangeExpr:
+		typ := c.expr(expr.Min)
+		c.expr(expr.Max)
+		return typ
+	case *ast.SetExpr:
+		var elemType ast.TypeSpec
+		for i, value := range expr.Values {
+			typ := c.expr(value)
+			if i == 0 {
+				elemType = typ
+			}
+		}
+		return &ast.SetSpec{Of: elemType} // element type nil for []
+	case *ast.TypeConvExpr:
+		c.typeIdent(expr.Type)
+		c.expr(expr.Expr)
+		return &ast.IdentSpec{Type: expr.Type}
+	case *ast.UnaryExpr:
+		return c.expr(expr.Expr)
+	case *ast.WidthExpr:
+		c.expr(expr.Width)
+		return c.expr(expr.Expr)
+	default:
+		panic(fmt.Sprintf("unexpected Expr type: %T", expr))
+	}
+}
+
+// binaryType returns the result type of a binary expression whose
+// operands have the given (resolved) types.
+func (c *checker) binaryType(expr *ast.BinaryExpr, left, right ast.TypeSpec) ast.TypeSpec {
+	left, right = c.info.Underlying(left), c.info.Underlying(right)
+	switch expr.Op {
+	case token.EQUALS, token.NOT_EQUALS, token.LESS, token.LTE, token.GREATER, token.GTE:
+		c.numericOperands(expr, c.commonType(expr, left, right))
+		return Boolean
+	case token.IN:
+		return Boolean
+	case token.AND, token.OR, token.XOR:
+		if left == Boolean && right == Boolean {
+			return Boolean
+		}
+	case token.PLUS, token.MINUS, token.STAR:
+		// Union, difference, and intersection of sets
+		if _, isSet := left.(*ast.SetSpec); isSet {
+			return left
+		}
+		if _, isSet := right.(*ast.SetSpec); isSet {
+			return right
+		}
+		if expr.Op == token.PLUS && isString(left) && isString(right) {
+			return String
+		}
+	case token.SLASH:
+		// Division always gives a real, even for integer operands
+		if !IsReal(left) {
+			left = Real
+		}
+		if !IsReal(right) {
+			right = Real
+		}
+	}
+	typ := c.commonType(expr, left, right)
+	if typ == Shortint || typ == Byte {
+		// Turbo Pascal does byte arithmetic at integer width
+		typ = Integer
+	}
+	c.numericOperands(expr, typ)
+	return typ
+}
+
+// commonType returns the type that operands of the given types are
+// converted to for arithmetic or comparison: the real type if either
+// is real, otherwise their common integer type.
+func (c *checker) commonType(expr *ast.BinaryExpr, left, right ast.TypeSpec) ast.TypeSpec {
+	if IsReal(left) || IsReal(right) {
+		return commonRealType(left, right)
+	}
+	if left == UntypedInt && right == UntypedInt {
+		return UntypedInt
+	}
+	return commonIntType(c.intType(expr.Left, left), c.intType(expr.Right, right))
+}
+
+// numericOperands records the type that the operands of expr are
+// converted to, if it's a number type.
+func (c *checker) numericOperands(expr *ast.BinaryExpr, typ ast.TypeSpec) {
+	if IsInteger(typ) || IsReal(typ) {
+		c.info.Operands[expr] = typ
+	}
+}
+
+// isString reports whether typ is a string or char type (adding
+// chars gives a string).
+func isString(typ ast.TypeSpec) bool {
+	_, isStringSpec := typ.(*ast.StringSpec)
+	return isStringSpec || typ == String || typ == Char
+}
+
+// IsReal reports whether typ (a type from Info.Types) is one of the
+// real types. Comp is a real type in Turbo Pascal, even though it
+// only holds whole numbers.
+func IsReal(typ ast.TypeSpec) bool {
+	return typ == Real || typ == Single || typ == Double || typ == Extended || typ == Comp
+}
+
+// commonRealType returns the type of arithmetic on the given types,
+// at least one of which is a real type. An integer operand is
+// converted to the other operand's type; Turbo Pascal does
+// arithmetic on two different real types in Extended.
+func commonRealType(left, right ast.TypeSpec) ast.TypeSpec {
+	switch {
+	case !IsReal(left):
+		return right
+	case !IsReal(right):
+		return left
+	case left == right:
+		return left
+	default:
+		return Extended
+	}
+}
+
+// Integer types in order of size, with their ranges.
+var intTypes = []struct {
+	typ      *ast.IdentSpec
+	min, max int
+}{
+	{Shortint, -128, 127},
+	{Byte, 0, 255},
+	{Integer, -32768, 32767},
+	{Word, 0, 65535},
+	{Longint, -2147483648, 2147483647},
+}
+
+// intType returns the integer type of an operand, giving an untyped
+// constant the smallest integer type that holds its value.
+func (c *checker) intType(expr ast.Expr, typ ast.TypeSpec) ast.TypeSpec {
+	if typ != UntypedInt {
+		return typ
+	}
+	value, ok := c.info.IntValue(expr)
+	if !ok {
+		return Integer
+	}
+	for _, t := range intTypes {
+		if value >= t.min && value <= t.max {
+			return t.typ
+		}
+	}
+	return Longint
+}
+
+// ordValue returns the ordinal value of a constant of an ordinal
+// type, and its type (nil for an integer), if expr is one.
+func (c *checker) ordValue(expr ast.Expr) (int, ast.TypeSpec, bool) {
+	if value, ok := c.info.IntValue(expr); ok {
+		return value, nil, true
+	}
+	switch expr := expr.(type) {
+	case *ast.ConstExpr:
+		switch value := expr.Value.(type) {
+		case string:
+			if len(value) == 1 {
+				return int(value[0]), Char, true
+			}
+		case bool:
+			if value {
+				return 1, Boolean, true
+			}
+			return 0, Boolean, true
+		}
+	case *ast.IdentExpr:
+		sym := c.info.Uses[expr]
+		if sym == nil || sym.Kind != SymConst {
+			break
+		}
+		switch decl := sym.Decl.(type) {
+		case *ast.ScalarSpec:
+			for i, name := range decl.Names {
+				if strings.EqualFold(name, sym.Name) {
+					return i, decl, true
+				}
+			}
+		case *ast.ConstDecl:
+			if decl.Type == nil {
+				return c.ordValue(decl.Value)
+			}
+		}
+	case *ast.ParenExpr:
+		return c.ordValue(expr.Expr)
+	}
+	return 0, nil, false
+}
+
+// commonIntType returns the smallest integer type that holds all the
+// values of both the given types, which is what Turbo Pascal uses
+// for arithmetic on them. It returns the type itself if both are the
+// same non-integer type (for example Boolean), and nil if the types
+// aren't compatible.
+func commonIntType(left, right ast.TypeSpec) ast.TypeSpec {
+	if left == right {
+		return left
+	}
+	leftIndex, rightIndex := intTypeIndex(left), intTypeIndex(right)
+	if leftIndex < 0 || rightIndex < 0 {
+		return nil
+	}
+	min := intTypes[leftIndex].min
+	if intTypes[rightIndex].min < min {
+		min = intTypes[rightIndex].min
+	}
+	max := intTypes[leftIndex].max
+	if intTypes[rightIndex].max > max {
+		max = intTypes[rightIndex].max
+	}
+	for _, t := range intTypes {
+		if min >= t.min && max <= t.max {
+			return t.typ
+		}
+	}
+	return Longint
+}
+
+// IsInteger reports whether typ (a type from Info.Types) is one of
+// the integer types, including UntypedInt.
+func IsInteger(typ ast.TypeSpec) bool {
+	return typ == UntypedInt || intTypeIndex(typ) >= 0
+}
+
+func intTypeIndex(typ ast.TypeSpec) int {
+	for i, t := range intTypes {
+		if typ == ast.TypeSpec(t.typ) {
+			return i
+		}
+	}
+	return -1
+}
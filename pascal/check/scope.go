@@ -0,0 +1,238 @@
+package check
+
+import (
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+)
+
+// Scope is a set of declared names, and the scope enclosing it.
+type Scope struct {
+	Kind   ScopeKind
+	Parent *Scope
+	// Node that opened the scope: the Program, Unit, ProcDecl,
+	// FuncDecl, WithStmt, or (for an object scope) ObjectSpec. It's
+	// nil for the universe and uses scopes.
+	Node ast.Node
+	// Symbols declared in this scope, keyed by lowercase name.
+	Symbols map[string]*Symbol
+}
+
+type ScopeKind int
+
+const (
+	ScopeNone     ScopeKind = iota
+	ScopeUniverse           // builtin types, procedures, and functions
+	ScopeUses               // interface declarations of the units a file uses
+	ScopeGlobal             // top-level declarations of a program or unit
+	ScopeLocal              // parameters and declarations of a procedure or function
+	ScopeWith               // record fields brought into scope by a "with"
+	ScopeObject             // fields and methods of an object type (and Self, in a method)
+)
+
+func newScope(kind ScopeKind, parent *Scope, node ast.Node) *Scope {
+	return &Scope{
+		Kind:    kind,
+		Parent:  parent,
+		Node:    node,
+		Symbols: make(map[string]*Symbol),
+	}
+}
+
+// Lookup returns the symbol with the given name (case insensitive)
+// in this scope or the nearest enclosing scope that declares it, or
+// nil if there's no such symbol.
+func (s *Scope) Lookup(name string) *Symbol {
+	name = strings.ToLower(name)
+	for ; s != nil; s = s.Parent {
+		if sym := s.Symbols[name]; sym != nil {
+			return sym
+		}
+	}
+	return nil
+}
+
+// Symbol is a declared name: a constant, type, variable, parameter,
+// procedure, function, record field, or object field or method.
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// Declared type, which may be an *ast.IdentSpec naming another
+	// type (use Info.Resolve to look through that). For a procedure
+	// or function this is its ProcSpec or FuncSpec, for an untyped
+	// constant it's the type of its value, and for a type it's the
+	// type's definition. It's nil for builtins with no fixed type.
+	Type ast.TypeSpec
+	// Node that declares the symbol: a ConstDecl, TypeDef, VarDecl,
+	// ParamGroup, ProcDecl, FuncDecl, RecordSection, RecordVariant
+	// (for a variant record's tag field), or (for enumerated values)
+	// ScalarSpec. An object's method is declared by its heading in
+	// the ObjectSpec, and Self by the method's ProcDecl or FuncDecl.
+	// It's nil for builtins.
+	Decl ast.Node
+	// Scope the symbol is declared in. For a record field brought
+	// into scope by a "with", this is the with statement's scope
+	// (its Node is the *ast.WithStmt), and for an object's field or
+	// method used in a method body, the object scope. It's nil for
+	// fields and methods selected with a dot.
+	Scope *Scope
+	// Name of the unit that declares the symbol, or "" for symbols
+	// declared in a program, and builtins.
+	Unit string
+}
+
+type SymbolKind int
+
+const (
+	SymNone     SymbolKind = iota
+	SymBuiltin             // builtin procedure or function with no fixed signature
+	SymConst               // constant, including enumerated type values
+	SymType                // type
+	SymVar                 // variable
+	SymParam               // value parameter
+	SymVarParam            // "var" parameter
+	SymProc                // procedure
+	SymFunc                // function
+	SymField               // record or object field
+)
+
+// Builtin types. Expressions of these types have one of these
+// *ast.IdentSpec values as their type in Info.Types.
+var (
+	Boolean  = builtinType("Boolean")
+	Byte     = builtinType("Byte")
+	Char     = builtinType("Char")
+	Comp     = builtinType("Comp")
+	Double   = builtinType("Double")
+	Extended = builtinType("Extended")
+	Integer  = builtinType("Integer")
+	Longint  = builtinType("Longint")
+	Pointer  = builtinType("Pointer")
+	Real     = builtinType("Real")
+	Shortint = builtinType("Shortint")
+	Single   = builtinType("Single")
+	String   = builtinType("String")
+	Word     = builtinType("Word")
+
+	// UntypedInt is the type of integer literals and of the untyped
+	// constants declared with them. Turbo Pascal gives these the
+	// smallest integer type that holds the value, but they can be
+	// used wherever an integer type is expected.
+	UntypedInt = builtinType("untyped integer")
+)
+
+func builtinType(name string) *ast.IdentSpec {
+	return &ast.IdentSpec{Type: &ast.TypeIdent{Name: name}}
+}
+
+// Builtin procedures and functions from the System unit. These have
+// irregular signatures (optional or any-type arguments), so their
+// symbols have no type.
+var builtinProcs = []string{
+	"Abs", "Addr", "Append", "ArcTan", "Assign", "BlockRead",
+	"BlockWrite", "ChDir", "Close", "Concat", "Cos", "CSeg", "Dec",
+	"Delete", "Dispose", "DSeg", "Eof", "Eoln", "Erase", "Exclude",
+	"Exit", "Exp", "FilePos", "FileSize", "FillChar", "Frac", "FreeMem",
+	"GetMem", "Halt", "Hi", "Inc", "Include", "Insert", "Int", "Ln",
+	"Lo", "MaxAvail", "MemAvail", "MkDir", "Move", "New", "Odd", "Ofs",
+	"Ord", "ParamCount", "ParamStr", "Pi", "Pos", "Pred", "Ptr",
+	"Randomize", "Read", "ReadLn", "Rename", "Reset", "Rewrite",
+	"RmDir", "Round", "Seg", "Sin", "SizeOf", "SPtr", "Sqrt", "SSeg",
+	"Str", "Succ", "Swap", "Truncate", "Val", "Write", "WriteLn",
+}
+
+// Builtin variables and constants with no useful type.
+var builtinVars = []string{
+	"Input", "MaxInt", "MaxLongint", "Mem", "MemL", "MemW", "Output",
+	"PortW",
+}
+
+// universe returns a new scope with the builtin declarations.
+func (c *checker) universe() *Scope {
+	scope := newScope(ScopeUniverse, nil, nil)
+	c.scope = scope
+
+	for _, typ := range []*ast.IdentSpec{Boolean, Byte, Char, Comp, Double, Extended, Integer, Longint, Pointer, Real, Shortint, Single, String, Word} {
+		sym := c.declare(typ.Type.Name, SymType, typ, nil)
+		c.info.TypeNames[typ.Type] = sym
+	}
+	// UntypedInt can't be named in Pascal code, so isn't declared
+	c.info.TypeNames[UntypedInt.Type] = &Symbol{Name: UntypedInt.Type.Name, Kind: SymType, Type: UntypedInt}
+	c.declare("Text", SymType, &ast.FileSpec{}, nil)
+	for _, name := range builtinProcs {
+		c.declare(name, SymBuiltin, nil, nil)
+	}
+	for _, name := range builtinVars {
+		c.declare(name, SymVar, nil, nil)
+	}
+
+	// Builtins with fixed signatures (or those in VIDEO.PAS)
+	c.declareBuiltin("Chr", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{{IsVar: false, Names: []string{"x"}, Type: &ast.TypeIdent{Name: "byte"}}},
+		Result: &ast.TypeIdent{Name: "string"},
+	})
+	c.declareBuiltin("Copy", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{
+			{IsVar: false, Names: []string{"s"}, Type: &ast.TypeIdent{Name: "string"}},
+			{IsVar: false, Names: []string{"index", "count"}, Type: &ast.TypeIdent{Name: "integer"}}},
+		Result: &ast.TypeIdent{Name: "string"},
+	})
+	c.declareBuiltin("GetTime", SymProc, &ast.ProcSpec{Params: []*ast.ParamGroup{
+		{IsVar: true, Names: []string{"h", "m", "s", "s100"}, Type: &ast.TypeIdent{Name: "word"}}}})
+	c.declareBuiltin("IOResult", SymFunc, &ast.FuncSpec{
+		Result: &ast.TypeIdent{Name: "integer"},
+	})
+	c.declareBuiltin("KeyPressed", SymFunc, &ast.FuncSpec{
+		Result: &ast.TypeIdent{Name: "boolean"},
+	})
+	c.declareBuiltin("Length", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{{IsVar: false, Names: []string{"s"}, Type: &ast.TypeIdent{Name: "string"}}},
+		Result: &ast.TypeIdent{Name: "integer"},
+	})
+	c.declareBuiltin("Port", SymVar, &ast.ArraySpec{
+		Min: &ast.ConstExpr{Value: 0},
+		Max: &ast.ConstExpr{Value: 1000},
+		Of:  &ast.IdentSpec{Type: &ast.TypeIdent{Name: "integer"}},
+	})
+	c.declareBuiltin("Random", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{{IsVar: false, Names: []string{"end"}, Type: &ast.TypeIdent{Name: "integer"}}},
+		Result: &ast.TypeIdent{Name: "integer"},
+	})
+	c.declareBuiltin("ReadKey", SymFunc, &ast.FuncSpec{
+		Result: &ast.TypeIdent{Name: "char"},
+	})
+	c.declareBuiltin("Seek", SymProc, &ast.ProcSpec{Params: []*ast.ParamGroup{
+		{IsVar: false, Names: []string{"f"}, Type: &ast.TypeIdent{Name: "text"}},
+		{IsVar: false, Names: []string{"n"}, Type: &ast.TypeIdent{Name: "longint"}}}})
+	c.declareBuiltin("Sqr", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{{IsVar: false, Names: []string{"n"}, Type: &ast.TypeIdent{Name: "integer"}}},
+		Result: &ast.TypeIdent{Name: "integer"},
+	})
+	c.declareBuiltin("Trunc", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{{IsVar: false, Names: []string{"x"}, Type: &ast.TypeIdent{Name: "real"}}},
+		Result: &ast.TypeIdent{Name: "integer"},
+	})
+	c.declareBuiltin("UpCase", SymFunc, &ast.FuncSpec{
+		Params: []*ast.ParamGroup{{IsVar: false, Names: []string{"ch"}, Type: &ast.TypeIdent{Name: "char"}}},
+		Result: &ast.TypeIdent{Name: "char"},
+	})
+	c.declareBuiltin("VideoMove", SymProc, &ast.ProcSpec{Params: []*ast.ParamGroup{
+		{IsVar: false, Names: []string{"x", "y", "chars"}, Type: &ast.TypeIdent{Name: "integer"}},
+		{IsVar: false, Names: []string{"data"}, Type: &ast.TypeIdent{Name: "pointer"}},
+		{IsVar: false, Names: []string{"toVideo"}, Type: &ast.TypeIdent{Name: "boolean"}}}})
+	c.declareBuiltin("VideoWriteText", SymProc, &ast.ProcSpec{Params: []*ast.ParamGroup{
+		{IsVar: false, Names: []string{"x", "y"}, Type: &ast.TypeIdent{Name: "integer"}},
+		{IsVar: false, Names: []string{"color"}, Type: &ast.TypeIdent{Name: "byte"}},
+		{IsVar: false, Names: []string{"text"}, Type: &ast.TypeIdent{Name: "string"}}}})
+
+	c.declareBuiltin("TVideoLine", SymType, &ast.StringSpec{Size: 80})
+
+	return scope
+}
+
+// declareBuiltin declares a builtin with the given type, resolving
+// the type names the type refers to.
+func (c *checker) declareBuiltin(name string, kind SymbolKind, typ ast.TypeSpec) {
+	c.typeSpec(typ)
+	c.declare(name, kind, typ, nil)
+}
@@ -0,0 +1,359 @@
+// Package lexer is a Turbo Pascal lexer.
+//
+// The lexer turns a string of Pascal source code into a stream of
+// tokens for parsing.
+//
+// To tokenize some source, create a new lexer with New(src, filename,
+// dialect) and then call Scan() until the token type is EOF or
+// ILLEGAL. To also handle conditional compilation and include files,
+// wrap the lexer in a Preprocessor and call its Scan() instead.
+package lexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// Lexer tokenizes a byte string of source code. Use New to
+// actually create a lexer, and Scan() to get tokens.
+type Lexer struct {
+	src      []byte
+	dialect  Dialect
+	offset   int
+	ch       byte
+	pos      token.Position
+	nextPos  token.Position
+	comments []*token.Comment
+}
+
+// Dialect is the Pascal dialect the lexer accepts.
+type Dialect int
+
+const (
+	// Turbo Pascal: { ... } and (* ... *) comments.
+	TurboPascal Dialect = iota
+	// Delphi: like Turbo Pascal, but also // line comments.
+	Delphi
+)
+
+// New creates a new lexer that will tokenize the given source code
+// (from the named file) in the given dialect.
+func New(src []byte, filename string, dialect Dialect) *Lexer {
+	l := &Lexer{src: src, dialect: dialect}
+	l.nextPos.Filename = filename
+	l.nextPos.Line = 1
+	l.nextPos.Column = 1
+	l.next()
+	return l
+}
+
+// EndPos returns the position just past the end of the last token
+// returned by Scan.
+func (l *Lexer) EndPos() token.Position {
+	return l.pos
+}
+
+// Scan scans the next token and returns its position (line/column),
+// token value (one of the uppercased token constants), and the
+// string value of the token. For most tokens, the token value is
+// empty. For IDENT, NUM, and STR tokens, it's the token's value.
+// For a DIRECTIVE token, it's the text after the "$" (for example
+// "I-" for {$I-}). For an ILLEGAL token, it's the error message.
+func (l *Lexer) Scan() (token.Position, token.Token, string) {
+	// Skip whitespace and comments
+	for {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' || l.ch == '\n' {
+			l.next()
+		}
+		if !l.atComment() {
+			break
+		}
+		pos := l.pos
+		text, isDirective, errMsg := l.comment()
+		if errMsg != "" {
+			return pos, token.ILLEGAL, errMsg
+		}
+		if isDirective {
+			return pos, token.DIRECTIVE, text[1:]
+		}
+	}
+	if l.ch == 0 {
+		// l.next() reached end of input
+		return l.pos, token.EOF, ""
+	}
+
+	pos := l.pos
+	tok := token.ILLEGAL
+	val := ""
+
+	ch := l.ch
+	l.next()
+
+	// Names: keywords and functions
+	if isNameStart(ch) {
+		start := l.offset - 2
+		for isNameStart(l.ch) || (l.ch >= '0' && l.ch <= '9') || l.ch == '_' {
+			l.next()
+		}
+		name := string(l.src[start : l.offset-1])
+		tok := token.KeywordToken(name)
+		if tok == token.ILLEGAL {
+			tok = token.IDENT
+			val = name
+		}
+		return pos, tok, val
+	}
+
+	switch ch {
+	case '@':
+		tok = token.AT
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		// integer: ('0' .. '9')+
+		// real: ('0' .. '9')+ (('.' ('0' .. '9')+ (EXPONENT)?)? | EXPONENT)
+		// exponent: ('e' | 'E') ('+' | '-')? ('0' .. '9')+
+		start := l.offset - 2
+		for l.ch >= '0' && l.ch <= '9' {
+			l.next()
+		}
+		if l.ch == '.' && l.peekNext() != '.' {
+			l.next()
+			gotDigit := false
+			for l.ch >= '0' && l.ch <= '9' {
+				l.next()
+				gotDigit = true
+			}
+			if !gotDigit {
+				return l.pos, token.ILLEGAL, "expected digits after '.'"
+			}
+		}
+		if l.ch == 'e' || l.ch == 'E' {
+			l.next()
+			if l.ch == '+' || l.ch == '-' {
+				l.next()
+			}
+			gotDigit := false
+			for l.ch >= '0' && l.ch <= '9' {
+				l.next()
+				gotDigit = true
+			}
+			if !gotDigit {
+				return l.pos, token.ILLEGAL, "expected digits after 'e'"
+			}
+		}
+		tok = token.NUM
+		val = string(l.src[start : l.offset-1])
+	case '$':
+		l.next()
+		start := l.offset - 2
+		for isHexDigit(l.ch) {
+			l.next()
+		}
+		tok = token.HEX
+		val = string(l.src[start : l.offset-1])
+	case ':':
+		tok = l.choice('=', token.COLON, token.ASSIGN)
+	case '=':
+		tok = token.EQUALS
+	case '<':
+		switch l.ch {
+		case '=':
+			l.next()
+			tok = token.LTE
+		case '>':
+			l.next()
+			tok = token.NOT_EQUALS
+		default:
+			tok = token.LESS
+		}
+	case '>':
+		tok = l.choice('=', token.GREATER, token.GTE)
+	case '\'', '#':
+		chars := make([]byte, 0, 32) // most won't require heap allocation
+		for {
+			if ch == '\'' {
+				for {
+					c := l.ch
+					if c == 0 {
+						return l.pos, token.ILLEGAL, "didn't find end quote in string"
+					}
+					if c == '\r' || c == '\n' {
+						return l.pos, token.ILLEGAL, "can't have newline in string"
+					}
+					if c == '\'' {
+						l.next()
+						if l.ch != '\'' {
+							break
+						}
+					}
+					chars = append(chars, c)
+					l.next()
+				}
+			} else { // '#'
+				num := 0
+				for l.ch >= '0' && l.ch <= '9' {
+					num = num*10 + int(l.ch-'0')
+					if num > 255 {
+						return l.pos, token.ILLEGAL, "#char greater than 255"
+					}
+					l.next()
+				}
+				chars = append(chars, byte(num))
+			}
+			if l.ch != '\'' && l.ch != '#' {
+				break
+			}
+			ch = l.ch
+			l.next()
+		}
+		tok = token.STR
+		val = string(chars)
+	case '(':
+		tok = token.LPAREN
+	case ')':
+		tok = token.RPAREN
+	case ',':
+		tok = token.COMMA
+	case ';':
+		tok = token.SEMICOLON
+	case '+':
+		tok = token.PLUS
+	case '-':
+		tok = token.MINUS
+	case '*':
+		tok = token.STAR
+	case '/':
+		tok = token.SLASH
+	case '[':
+		tok = token.LBRACKET
+	case ']':
+		tok = token.RBRACKET
+	case '^':
+		tok = token.POINTER
+	case '.':
+		tok = l.choice('.', token.DOT, token.DOT_DOT)
+	default:
+		tok = token.ILLEGAL
+		val = fmt.Sprintf("unexpected char %q", ch)
+	}
+	return pos, tok, val
+}
+
+// Comments returns all the comments scanned so far, in source order.
+func (l *Lexer) Comments() []*token.Comment {
+	return l.comments
+}
+
+// Return true if the current character starts a comment.
+func (l *Lexer) atComment() bool {
+	switch l.ch {
+	case '{':
+		return true
+	case '(':
+		return l.peekNext() == '*'
+	case '/':
+		return l.dialect == Delphi && l.peekNext() == '/'
+	}
+	return false
+}
+
+// Scan a { ... }, (* ... *), or // comment and return its text. If
+// it's a compiler directive like {$I-}, return isDirective true,
+// otherwise record the comment. If the comment isn't terminated,
+// return an error message.
+func (l *Lexer) comment() (text string, isDirective bool, errMsg string) {
+	start := l.pos
+	var textStart, textEnd int
+	switch l.ch {
+	case '{':
+		l.next()
+		textStart = l.pos.Offset
+		for l.ch != '}' && l.ch != 0 {
+			l.next()
+		}
+		textEnd = l.pos.Offset
+		if l.ch == 0 {
+			return "", false, "didn't find end of comment"
+		}
+		l.next()
+	case '(':
+		l.next()
+		l.next()
+		textStart = l.pos.Offset
+		for !(l.ch == '*' && l.peekNext() == ')') && l.ch != 0 {
+			l.next()
+		}
+		textEnd = l.pos.Offset
+		if l.ch == 0 {
+			return "", false, "didn't find end of comment"
+		}
+		l.next()
+		l.next()
+	default: // "//"
+		l.next()
+		l.next()
+		textStart = l.pos.Offset
+		for l.ch != '\n' && l.ch != 0 {
+			l.next()
+		}
+		textEnd = l.pos.Offset
+		text = strings.TrimRight(string(l.src[textStart:textEnd]), "\r")
+		l.comments = append(l.comments, &token.Comment{StartPos: start, EndPos: l.pos, Text: text})
+		return text, false, ""
+	}
+	text = string(l.src[textStart:textEnd])
+	if strings.HasPrefix(text, "$") {
+		return text, true, ""
+	}
+	l.comments = append(l.comments, &token.Comment{StartPos: start, EndPos: l.pos, Text: text})
+	return text, false, ""
+}
+
+// Load the next character into l.ch (or 0 on end of input) and update
+// line and column position.
+func (l *Lexer) next() {
+	l.pos = l.nextPos
+	if l.offset >= len(l.src) {
+		// For last character, move offset 1 past the end as it
+		// simplifies offset calculations in IDENT and NUMBER
+		if l.ch != 0 {
+			l.ch = 0
+			l.offset++
+		}
+		return
+	}
+	ch := l.src[l.offset]
+	if ch == '\n' {
+		l.nextPos.Line++
+		l.nextPos.Column = 1
+	} else {
+		l.nextPos.Column++
+	}
+	l.nextPos.Offset++
+	l.ch = ch
+	l.offset++
+}
+
+func isNameStart(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isHexDigit(ch byte) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func (l *Lexer) choice(ch byte, one, two token.Token) token.Token {
+	if l.ch == ch {
+		l.next()
+		return two
+	}
+	return one
+}
+
+func (l *Lexer) peekNext() byte {
+	if l.offset >= len(l.src) {
+		return 0
+	}
+	return l.src[l.offset]
+}
@@ -0,0 +1,324 @@
+// Turbo Pascal conditional compilation and include files
+//
+// The preprocessor sits between the lexer and the parser. It handles
+// the {$DEFINE}, {$UNDEF}, {$IFDEF}, {$IFNDEF}, {$IFOPT}, {$ELSE},
+// and {$ENDIF} directives, and skips the tokens in conditional
+// branches that aren't taken. It also handles {$I filename} by
+// scanning the tokens of the included file in its place. As it works
+// on tokens rather than source text, token positions (including the
+// file name) are those of the original source.
+
+package lexer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// Preprocessor evaluates conditional compilation and include file
+// directives in the token stream from a Lexer. It has the same Scan,
+// EndPos, and Comments methods as Lexer, so the parser can use it in
+// place of one.
+type Preprocessor struct {
+	lexer       *Lexer
+	numComments int // number of the lexer's comments seen so far
+	includers   []includer
+	includePath []string
+	defines     map[string]bool
+	switches    token.Switches
+	conds       []condBlock
+	comments    []*token.Comment
+}
+
+// Lexer (and its comment count) of a file that's partway through
+// including another.
+type includer struct {
+	lexer       *Lexer
+	numComments int
+}
+
+// Maximum depth of nested include files (this prevents an infinite
+// loop when a file includes itself).
+const maxIncludeDepth = 16
+
+// State of a single {$IFxxx} ... {$ENDIF} block.
+type condBlock struct {
+	pos            token.Position // position of the {$IFxxx} directive
+	active         bool           // true if we're in the branch that's taken
+	parentSkipping bool           // true if an enclosing block is being skipped
+	seenElse       bool
+}
+
+// Symbols Turbo Pascal 5.5 defines for every compile.
+var predefinedSymbols = []string{"VER55", "MSDOS", "CPU86"}
+
+// NewPreprocessor creates a new preprocessor that reads tokens from
+// lexer, with the given conditional symbols defined (as well as the
+// predefined ones like VER55). Include files that aren't in the
+// including file's directory are searched for in includePath.
+func NewPreprocessor(lexer *Lexer, defines, includePath []string) *Preprocessor {
+	pp := &Preprocessor{
+		lexer:       lexer,
+		includePath: includePath,
+		defines:     make(map[string]bool),
+		switches:    token.DefaultSwitches,
+	}
+	for _, name := range predefinedSymbols {
+		pp.defines[name] = true
+	}
+	for _, name := range defines {
+		pp.defines[strings.ToUpper(name)] = true
+	}
+	return pp
+}
+
+// Scan returns the next token that's not in a skipped conditional
+// branch (see Lexer.Scan for details). Conditional directives are
+// handled here and not returned; other directives are returned as
+// DIRECTIVE tokens. Errors in conditional directives are returned as
+// ILLEGAL tokens.
+func (pp *Preprocessor) Scan() (token.Position, token.Token, string) {
+	for {
+		pos, tok, val := pp.lexer.Scan()
+		pp.takeComments()
+
+		switch {
+		case tok == token.EOF && len(pp.includers) > 0:
+			// End of included file, continue with the includer
+			pp.endInclude()
+			continue
+		case tok == token.EOF:
+			if len(pp.conds) > 0 {
+				pos := pp.conds[len(pp.conds)-1].pos
+				pp.conds = nil
+				return pos, token.ILLEGAL, "{$IF...} without matching {$ENDIF}"
+			}
+		case tok == token.DIRECTIVE:
+			name, arg := splitDirective(val)
+			switch name {
+			case "IFDEF", "IFNDEF", "IFOPT", "ELSE", "ENDIF":
+				if errMsg := pp.conditional(pos, name, arg); errMsg != "" {
+					return pos, token.ILLEGAL, errMsg
+				}
+				continue
+			case "DEFINE", "UNDEF":
+				if !pp.skipping() {
+					pp.defines[strings.ToUpper(arg)] = name == "DEFINE"
+				}
+				continue
+			}
+			if pp.skipping() {
+				continue
+			}
+			if isInclude(name, arg) {
+				if errMsg := pp.include(pos, arg); errMsg != "" {
+					return pos, token.ILLEGAL, errMsg
+				}
+				continue
+			}
+			pp.setSwitches(val)
+		case pp.skipping():
+			// Skip all tokens in an untaken branch, including
+			// ILLEGAL ones
+			continue
+		}
+		return pos, tok, val
+	}
+}
+
+// EndPos returns the position just past the end of the last token
+// returned by Scan.
+func (pp *Preprocessor) EndPos() token.Position {
+	return pp.lexer.EndPos()
+}
+
+// Switches returns the state of the switch directives at the last
+// token returned by Scan.
+func (pp *Preprocessor) Switches() token.Switches {
+	return pp.switches
+}
+
+// Comments returns all the comments scanned so far, in source order,
+// excluding those in skipped conditional branches.
+func (pp *Preprocessor) Comments() []*token.Comment {
+	return pp.comments
+}
+
+// Keep the comments the lexer scanned before the current token, unless
+// they're in a skipped branch.
+func (pp *Preprocessor) takeComments() {
+	comments := pp.lexer.Comments()
+	if !pp.skipping() {
+		pp.comments = append(pp.comments, comments[pp.numComments:]...)
+	}
+	pp.numComments = len(comments)
+}
+
+// Return true if the current token is in a branch that isn't taken.
+func (pp *Preprocessor) skipping() bool {
+	if len(pp.conds) == 0 {
+		return false
+	}
+	cond := pp.conds[len(pp.conds)-1]
+	return cond.parentSkipping || !cond.active
+}
+
+// Handle a conditional directive, returning an error message if it's
+// invalid.
+func (pp *Preprocessor) conditional(pos token.Position, name, arg string) string {
+	switch name {
+	case "IFDEF", "IFNDEF", "IFOPT":
+		var active bool
+		switch name {
+		case "IFDEF":
+			active = pp.defines[strings.ToUpper(arg)]
+		case "IFNDEF":
+			active = !pp.defines[strings.ToUpper(arg)]
+		default:
+			if len(arg) != 2 || (arg[1] != '+' && arg[1] != '-') {
+				return "expected switch like {$IFOPT I+}"
+			}
+			active = pp.switches.On(arg[0]) == (arg[1] == '+')
+		}
+		pp.conds = append(pp.conds, condBlock{
+			pos:            pos,
+			active:         active,
+			parentSkipping: pp.skipping(),
+		})
+	case "ELSE":
+		if len(pp.conds) == 0 {
+			return "{$ELSE} without {$IF...}"
+		}
+		cond := &pp.conds[len(pp.conds)-1]
+		if cond.seenElse {
+			return "more than one {$ELSE} for {$IF...}"
+		}
+		cond.seenElse = true
+		cond.active = !cond.active
+	case "ENDIF":
+		if len(pp.conds) == 0 {
+			return "{$ENDIF} without {$IF...}"
+		}
+		pp.conds = pp.conds[:len(pp.conds)-1]
+	}
+	return ""
+}
+
+// Return true if the directive is {$I filename} (or {$INCLUDE
+// filename}) rather than the {$I+} or {$I-} switch.
+func isInclude(name, arg string) bool {
+	switch name {
+	case "I":
+		return arg != "" && arg[0] != '+' && arg[0] != '-'
+	case "INCLUDE":
+		return arg != ""
+	}
+	return false
+}
+
+// Start scanning tokens from the named include file, returning an
+// error message if it can't be read.
+func (pp *Preprocessor) include(pos token.Position, name string) string {
+	if len(pp.includers) >= maxIncludeDepth {
+		return "include files nested too deeply"
+	}
+	path := findInclude(name, filepath.Dir(pos.Filename), pp.includePath)
+	if path == "" {
+		return "include file not found: " + name
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "error reading include file: " + err.Error()
+	}
+	pp.includers = append(pp.includers, includer{pp.lexer, pp.numComments})
+	pp.lexer = New(src, path, pp.lexer.dialect)
+	pp.numComments = 0
+	return ""
+}
+
+// Go back to scanning the file that included the current one.
+func (pp *Preprocessor) endInclude() {
+	last := pp.includers[len(pp.includers)-1]
+	pp.includers = pp.includers[:len(pp.includers)-1]
+	pp.lexer = last.lexer
+	pp.numComments = last.numComments
+}
+
+// Return the path of the named include file, looking first in dir
+// and then in the directories in includePath, or "" if it's not
+// found. As in Turbo Pascal, the default extension is .PAS. Names are
+// matched case-insensitively, as they were under DOS.
+func findInclude(name, dir string, includePath []string) string {
+	names := []string{name}
+	if filepath.Ext(name) == "" {
+		names = append(names, name+".PAS")
+	}
+	if filepath.IsAbs(name) {
+		for _, n := range names {
+			if fileExists(n) {
+				return n
+			}
+		}
+		return ""
+	}
+	for _, d := range append([]string{dir}, includePath...) {
+		for _, n := range names {
+			if path := findFileFold(d, n); path != "" {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Return the path of the named file in dir, ignoring case if there's
+// no exact match, or "" if there's no such file.
+func findFileFold(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if fileExists(path) {
+		return path
+	}
+	subdir, base := filepath.Split(path)
+	if subdir == "" {
+		subdir = "."
+	}
+	infos, err := ioutil.ReadDir(subdir)
+	if err != nil {
+		return ""
+	}
+	for _, info := range infos {
+		if !info.IsDir() && strings.EqualFold(info.Name(), base) {
+			return filepath.Join(subdir, info.Name())
+		}
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Record the state of switch directives like {$I-} or {$R+,S-}.
+func (pp *Preprocessor) setSwitches(text string) {
+	for _, sw := range strings.Split(text, ",") {
+		sw = strings.TrimSpace(sw)
+		if len(sw) == 2 && isNameStart(sw[0]) && (sw[1] == '+' || sw[1] == '-') {
+			pp.switches = pp.switches.Set(sw[0], sw[1] == '+')
+		}
+	}
+}
+
+// Split directive text like "IFDEF Debug" into its uppercased name
+// and its argument.
+func splitDirective(text string) (name, arg string) {
+	i := 0
+	for i < len(text) && isNameStart(text[i]) {
+		i++
+	}
+	return strings.ToUpper(text[:i]), strings.TrimSpace(text[i:])
+}
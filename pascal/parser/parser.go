@@ -0,0 +1,1309 @@
+// Package parser is a Turbo Pascal recursive descent parser.
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/benhoyt/pas2go/pascal/ast"
+	"github.com/benhoyt/pas2go/pascal/lexer"
+	"github.com/benhoyt/pas2go/pascal/token"
+)
+
+// Error (actually *Error) is the type of a single parse error; Parse
+// returns a list of these as an ErrorList.
+type Error struct {
+	// Source line/column position where the error occurred.
+	Position token.Position
+	// Error message.
+	Message string
+}
+
+// Error returns a formatted version of the error, including the line
+// and column numbers.
+func (e *Error) Error() string {
+	if e.Position.Filename != "" {
+		return fmt.Sprintf("parse error at %s:%d:%d: %s",
+			e.Position.Filename, e.Position.Line, e.Position.Column, e.Message)
+	}
+	return fmt.Sprintf("parse error at %d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+}
+
+// ErrorList is the type of error returned by Parse: a list of all
+// the parse errors found in the source, in source order.
+type ErrorList []*Error
+
+// Error returns all the errors formatted one per line.
+func (e ErrorList) Error() string {
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+// Options are the optional settings for Parse.
+type Options struct {
+	// Name of the source file, used in positions and to find the
+	// files it includes with {$I filename}.
+	Filename string
+	// Dialect of Pascal to accept (default lexer.TurboPascal).
+	Dialect lexer.Dialect
+	// Conditional symbols to define for {$IFDEF} and {$IFNDEF}, as
+	// if with {$DEFINE}.
+	Defines []string
+	// Directories to search for include files that aren't found in
+	// the including file's directory.
+	IncludePath []string
+}
+
+// Parse parses a single source file (program or unit), returning the
+// File instance. If there are errors, Parse returns them all as a
+// ErrorList value, along with as much of the File as it could parse
+// (which may be nil).
+func Parse(src []byte, options Options) (file ast.File, err error) {
+	l := lexer.New(src, options.Filename, options.Dialect)
+	scanner := lexer.NewPreprocessor(l, options.Defines, options.IncludePath)
+	p := parser{scanner: scanner, comments: make(ast.CommentMap), switches: make(ast.SwitchMap)}
+	defer func() {
+		// The parser uses panic with a *Error to signal parsing
+		// errors internally, and they're caught here. This
+		// significantly simplifies the recursive descent calls as
+		// we don't have to check errors everywhere. Most errors are
+		// recovered from lower down (see parser.try), but ones that
+		// can't be end up here.
+		if r := recover(); r != nil {
+			// Convert to Error or re-panic
+			p.addError(r.(*Error))
+			file = p.partial
+			setDirectives(file, p.directives)
+		}
+		if len(p.errors) > 0 {
+			err = p.errors
+		}
+	}()
+	p.try(p.next) // initialize p.tok
+	file = p.file()
+	setDirectives(file, p.directives)
+	return file, nil
+}
+
+// Parser state
+type parser struct {
+	// Preprocessor (which wraps the lexer) and current token values
+	scanner *lexer.Preprocessor
+	pos     token.Position // position of last token (tok)
+	tok     token.Token    // last lexed token
+	val     string         // string value of last token (or "")
+	end     token.Position // position just past the end of the token before tok
+
+	// Errors recovered from so far, and the file being parsed (to
+	// return a partial AST if the parser can't recover)
+	errors  ErrorList
+	partial ast.File
+
+	// Comments attached to nodes so far, and the number of the
+	// scanner's comments that have been attached
+	comments    ast.CommentMap
+	numComments int
+
+	// Compiler directives skipped over so far, and the switch state
+	// at each statement parsed
+	directives []*ast.Directive
+	switches   ast.SwitchMap
+}
+
+// Tokens to skip to when recovering from an error in a declaration or
+// statement, respectively.
+var (
+	declSyncTokens = []token.Token{token.CONST, token.CONSTRUCTOR, token.DESTRUCTOR, token.FUNCTION, token.LABEL, token.PROCEDURE, token.TYPE, token.VAR, token.BEGIN, token.IMPLEMENTATION, token.EOF}
+	stmtSyncTokens = []token.Token{token.SEMICOLON, token.END, token.UNTIL, token.CONST, token.CONSTRUCTOR, token.DESTRUCTOR, token.FUNCTION, token.LABEL, token.PROCEDURE, token.TYPE, token.VAR, token.IMPLEMENTATION, token.EOF}
+)
+
+func (p *parser) file() ast.File {
+	switch p.tok {
+	case token.PROGRAM:
+		return p.program()
+	case token.UNIT:
+		return p.unit()
+	default:
+		panic(p.error("expected program or unit"))
+	}
+}
+
+func (p *parser) program() *ast.Program {
+	program := &ast.Program{Comments: p.comments, Switches: p.switches}
+	p.partial = program
+	program.Doc = p.leadingComments()
+
+	pos := p.pos
+	p.expect(token.PROGRAM)
+	program.Name = p.val
+	p.expect(token.IDENT)
+	p.expect(token.SEMICOLON)
+
+	program.Uses = p.optionalUses()
+
+	program.Decls = p.declParts(true, token.CONST, token.CONSTRUCTOR, token.DESTRUCTOR, token.FUNCTION, token.LABEL, token.PROCEDURE, token.TYPE, token.VAR)
+
+	program.Stmt = p.compoundStmt()
+	p.expect(token.DOT)
+	program.Span = p.span(pos)
+	p.addEndComments(program)
+	p.expect(token.EOF)
+
+	return program
+}
+
+func (p *parser) unit() *ast.Unit {
+	unit := &ast.Unit{Comments: p.comments, Switches: p.switches}
+	p.partial = unit
+	unit.Doc = p.leadingComments()
+
+	pos := p.pos
+	p.expect(token.UNIT)
+	unit.Name = p.val
+	p.expect(token.IDENT)
+	p.expect(token.SEMICOLON)
+
+	p.expect(token.INTERFACE)
+	unit.InterfaceUses = p.optionalUses()
+	unit.Interface = p.declParts(false, token.CONST, token.FUNCTION, token.PROCEDURE, token.TYPE, token.VAR)
+
+	p.expect(token.IMPLEMENTATION)
+	unit.ImplementationUses = p.optionalUses()
+	unit.Implementation = p.declParts(true, token.CONST, token.CONSTRUCTOR, token.DESTRUCTOR, token.FUNCTION, token.LABEL, token.PROCEDURE, token.TYPE, token.VAR)
+
+	unit.Init = p.compoundStmt()
+	p.expect(token.DOT)
+	unit.Span = p.span(pos)
+	p.addEndComments(unit)
+	p.expect(token.EOF)
+
+	return unit
+}
+
+func (p *parser) optionalUses() []string {
+	var usesList []string
+	if p.tok == token.USES {
+		p.next()
+		usesList = p.identList()
+		p.expect(token.SEMICOLON)
+	}
+	return usesList
+}
+
+func (p *parser) declParts(allowBodies bool, tokens ...token.Token) []ast.DeclPart {
+	var decls []ast.DeclPart
+	for p.matches(tokens...) {
+		p.try(func() {
+			leading := p.leadingComments()
+			decl := p.declPart(allowBodies)
+			p.addComments(decl, leading, nil)
+			decls = append(decls, decl)
+		}, declSyncTokens...)
+	}
+	return decls
+}
+
+func (p *parser) identList() []string {
+	idents := []string{p.val}
+	p.expect(token.IDENT)
+	for p.tok == token.COMMA {
+		p.next()
+		idents = append(idents, p.val)
+		p.expect(token.IDENT)
+	}
+	return idents
+}
+
+func (p *parser) declPart(allowBodies bool) ast.DeclPart {
+	pos := p.pos
+	switch p.tok {
+	case token.LABEL:
+		p.next()
+		names := p.identList()
+		p.expect(token.SEMICOLON)
+		return &ast.LabelDecls{Labels: names, Span: p.span(pos)}
+	case token.CONST:
+		p.next()
+		decls := []*ast.ConstDecl{}
+		for p.tok == token.IDENT {
+			p.tryItem(func() {
+				leading := p.leadingComments()
+				itemPos := p.pos
+				name := p.val
+				p.expect(token.IDENT)
+				var typ ast.TypeSpec
+				if p.tok == token.COLON {
+					p.next()
+					typ = p.typeSpec()
+				}
+				p.expect(token.EQUALS)
+				value := p.constDeclValue()
+				p.expect(token.SEMICOLON)
+				decl := &ast.ConstDecl{Name: name, Type: typ, Value: value, Span: p.span(itemPos)}
+				p.addComments(decl, leading, p.trailingComments(decl))
+				decls = append(decls, decl)
+			})
+		}
+		if len(decls) == 0 {
+			panic(p.error("expected const declaration"))
+		}
+		return &ast.ConstDecls{Decls: decls, Span: p.span(pos)}
+	case token.TYPE:
+		p.next()
+		defs := []*ast.TypeDef{}
+		for p.tok == token.IDENT {
+			p.tryItem(func() {
+				leading := p.leadingComments()
+				itemPos := p.pos
+				name := p.val
+				p.expect(token.IDENT)
+				p.expect(token.EQUALS)
+				spec := p.typeSpecWithFuncProc()
+				p.expect(token.SEMICOLON)
+				def := &ast.TypeDef{Name: name, Type: spec, Span: p.span(itemPos)}
+				p.addComments(def, leading, p.trailingComments(def))
+				defs = append(defs, def)
+			})
+		}
+		if len(defs) == 0 {
+			panic(p.error("expected type definition"))
+		}
+		return &ast.TypeDefs{Defs: defs, Span: p.span(pos)}
+	case token.VAR:
+		p.next()
+		decls := []*ast.VarDecl{}
+		for p.tok == token.IDENT {
+			p.tryItem(func() {
+				leading := p.leadingComments()
+				itemPos := p.pos
+				names := p.identList()
+				p.expect(token.COLON)
+				typ := p.typeSpec()
+				p.expect(token.SEMICOLON)
+				decl := &ast.VarDecl{Names: names, Type: typ, Span: p.span(itemPos)}
+				p.addComments(decl, leading, p.trailingComments(decl))
+				decls = append(decls, decl)
+			})
+		}
+		if len(decls) == 0 {
+			panic(p.error("expected var declaration"))
+		}
+		return &ast.VarDecls{Decls: decls, Span: p.span(pos)}
+	case token.PROCEDURE, token.CONSTRUCTOR, token.DESTRUCTOR:
+		kind := ast.Procedure
+		switch p.tok {
+		case token.CONSTRUCTOR:
+			kind = ast.Constructor
+		case token.DESTRUCTOR:
+			kind = ast.Destructor
+		}
+		p.next()
+		object, name := p.procName()
+		params := p.optionalParamList()
+		p.expect(token.SEMICOLON)
+
+		if p.tok == token.INTERRUPT {
+			p.next()
+			p.expect(token.SEMICOLON)
+		}
+
+		decl := &ast.ProcDecl{Kind: kind, Object: object, Name: name, Params: params}
+		if allowBodies {
+			decl.Forward, decl.External, decl.Inline = p.directive()
+		}
+		if allowBodies && !decl.Forward && !decl.External && decl.Inline == nil {
+			decl.Decls = p.declParts(allowBodies, token.CONST, token.FUNCTION, token.LABEL, token.PROCEDURE, token.TYPE, token.VAR)
+			decl.Stmt = p.compoundStmt()
+			p.expect(token.SEMICOLON)
+		}
+		decl.Span = p.span(pos)
+		return decl
+	case token.FUNCTION:
+		p.next()
+		object, name := p.procName()
+		params := p.optionalParamList()
+		var result *ast.TypeIdent
+		if p.tok == token.COLON {
+			// The result type (and parameters) can be omitted when
+			// defining a function declared earlier with "forward"
+			p.next()
+			result = p.typeIdent()
+		}
+		p.expect(token.SEMICOLON)
+
+		decl := &ast.FuncDecl{Object: object, Name: name, Params: params, Result: result}
+		if allowBodies {
+			decl.Forward, decl.External, decl.Inline = p.directive()
+		}
+		if allowBodies && !decl.Forward && !decl.External && decl.Inline == nil {
+			decl.Decls = p.declParts(allowBodies, token.CONST, token.FUNCTION, token.LABEL, token.PROCEDURE, token.TYPE, token.VAR)
+			decl.Stmt = p.compoundStmt()
+			p.expect(token.SEMICOLON)
+		}
+		decl.Span = p.span(pos)
+		return decl
+	default:
+		panic(p.error("expected declaration instead of %s", p.tok))
+	}
+}
+
+// directive: (FORWARD | EXTERNAL | INLINE LPAREN signedFactor (SLASH signedFactor)* RPAREN) SEMICOLON
+// A directive takes the place of a procedure or function's body. It
+// returns all zero values if there isn't one.
+func (p *parser) directive() (forward, external bool, inline []ast.Expr) {
+	switch {
+	case p.tok == token.INLINE:
+		// Elements are separated by slashes, so they're factors
+		// rather than expressions
+		p.next()
+		p.expect(token.LPAREN)
+		inline = []ast.Expr{p.signedFactor()}
+		for p.tok == token.SLASH {
+			p.next()
+			inline = append(inline, p.signedFactor())
+		}
+		p.expect(token.RPAREN)
+	case p.tok == token.IDENT && strings.ToLower(p.val) == "forward":
+		// "forward" and "external" are directives rather than
+		// reserved words
+		p.next()
+		forward = true
+	case p.tok == token.IDENT && strings.ToLower(p.val) == "external":
+		p.next()
+		external = true
+	default:
+		return false, false, nil
+	}
+	p.expect(token.SEMICOLON)
+	return forward, external, inline
+}
+
+// procName: IDENT (DOT IDENT)?
+// The second form names the method of an object type it implements.
+func (p *parser) procName() (*ast.TypeIdent, string) {
+	pos := p.pos
+	name := p.val
+	p.expect(token.IDENT)
+	if p.tok != token.DOT {
+		return nil, name
+	}
+	object := &ast.TypeIdent{Name: name, Span: p.span(pos)}
+	p.next()
+	name = p.val
+	p.expect(token.IDENT)
+	return object, name
+}
+
+func (p *parser) optionalParamList() []*ast.ParamGroup {
+	var groups []*ast.ParamGroup
+	if p.tok == token.LPAREN {
+		p.next()
+		groups = append(groups, p.paramGroup())
+		for p.tok == token.SEMICOLON {
+			p.next()
+			groups = append(groups, p.paramGroup())
+		}
+		p.expect(token.RPAREN)
+	}
+	return groups
+}
+
+func (p *parser) paramGroup() *ast.ParamGroup {
+	pos := p.pos
+	isVar := false
+	if p.matches(token.VAR) {
+		isVar = true
+		p.next()
+	}
+	names := p.identList()
+	p.expect(token.COLON)
+	typ := p.typeIdent()
+	return &ast.ParamGroup{IsVar: isVar, Names: names, Type: typ, Span: p.span(pos)}
+}
+
+func (p *parser) typeIdent() *ast.TypeIdent {
+	pos := p.pos
+	name := p.val
+	p.expect(token.IDENT)
+	return &ast.TypeIdent{Name: name, Span: p.span(pos)}
+}
+
+// typeSpec: type | functionType | procedureType
+func (p *parser) typeSpecWithFuncProc() ast.TypeSpec {
+	pos := p.pos
+	switch p.tok {
+	case token.PROCEDURE:
+		p.next()
+		params := p.optionalParamList()
+		return &ast.ProcSpec{Params: params, Span: p.span(pos)}
+	case token.FUNCTION:
+		p.next()
+		params := p.optionalParamList()
+		p.expect(token.COLON)
+		result := p.typeIdent()
+		return &ast.FuncSpec{Params: params, Result: result, Span: p.span(pos)}
+	default:
+		return p.typeSpec()
+	}
+}
+
+func (p *parser) typeSpec() ast.TypeSpec {
+	pos := p.pos
+	switch p.tok {
+	case token.LPAREN:
+		p.next()
+		names := p.identList()
+		p.expect(token.RPAREN)
+		return &ast.ScalarSpec{Names: names, Span: p.span(pos)}
+	case token.POINTER:
+		p.next()
+		typ := p.typeIdent()
+		return &ast.PointerSpec{Type: typ, Span: p.span(pos)}
+	case token.ARRAY:
+		p.next()
+		p.expect(token.LBRACKET)
+		indexes := []ast.TypeSpec{p.typeSpec()}
+		for p.tok == token.COMMA {
+			p.next()
+			indexes = append(indexes, p.typeSpec())
+		}
+		p.expect(token.RBRACKET)
+		p.expect(token.OF)
+		// array[a..b, c..d] of T is shorthand for
+		// array[a..b] of array[c..d] of T
+		spec := p.typeSpec()
+		for i := len(indexes) - 1; i >= 0; i-- {
+			spec = p.arraySpec(pos, indexes[i], spec)
+		}
+		return spec
+	case token.RECORD:
+		p.next()
+		sections := []*ast.RecordSection{}
+		// Only loop while there's a field name, as recovering from an
+		// error may stop at a keyword like CONST without consuming it
+		for p.tok == token.IDENT {
+			p.tryItem(func() {
+				sections = append(sections, p.recordSection())
+			})
+		}
+		var variant *ast.RecordVariant
+		if p.tok == token.CASE {
+			variant = p.recordVariant()
+		}
+		p.expect(token.END)
+		return &ast.RecordSpec{Sections: sections, Variant: variant, Span: p.span(pos)}
+	case token.OBJECT:
+		return p.objectSpec()
+	case token.FILE:
+		p.next()
+		var ofType ast.TypeSpec
+		if p.tok == token.OF {
+			p.next()
+			ofType = p.typeSpec()
+		}
+		return &ast.FileSpec{Of: ofType, Span: p.span(pos)}
+	case token.SET:
+		p.next()
+		p.expect(token.OF)
+		ofType := p.typeSpec()
+		return &ast.SetSpec{Of: ofType, Span: p.span(pos)}
+	default:
+		if p.tok == token.IDENT && strings.ToLower(p.val) == "string" {
+			p.next()
+			if p.tok != token.LBRACKET {
+				typ := &ast.TypeIdent{Name: "string", Span: p.span(pos)}
+				return &ast.IdentSpec{Type: typ, Span: p.span(pos)}
+			}
+			p.expect(token.LBRACKET)
+			size, err := strconv.Atoi(p.val)
+			if err != nil {
+				panic(p.error("expected integer"))
+			}
+			p.expect(token.NUM)
+			p.expect(token.RBRACKET)
+			return &ast.StringSpec{Size: size, Span: p.span(pos)}
+		}
+		switch p.tok {
+		case token.NUM, token.HEX, token.STR, token.PLUS, token.MINUS:
+			// Subrange of constants, like 1..60 or 'a'..'z'
+			min := p.expr()
+			return p.subrangeSpec(pos, min)
+		}
+		ident := p.typeIdent()
+		if p.tok == token.DOT_DOT {
+			// Subrange starting with a constant name, like Red..Blue
+			min := &ast.IdentExpr{Name: ident.Name, Span: ident.Span}
+			return p.subrangeSpec(pos, min)
+		}
+		return &ast.IdentSpec{Type: ident, Span: p.span(pos)}
+	}
+}
+
+// arraySpec returns an array type with the given index type, which
+// is either a subrange or a type name (as in array[TIndex]).
+func (p *parser) arraySpec(pos token.Position, index, ofType ast.TypeSpec) *ast.ArraySpec {
+	if subrange, isSubrange := index.(*ast.SubrangeSpec); isSubrange {
+		min, max := subrange.Min, subrange.Max
+		return &ast.ArraySpec{Min: min, Max: max, Of: ofType, Span: p.span(pos)}
+	}
+	return &ast.ArraySpec{Index: index, Of: ofType, Span: p.span(pos)}
+}
+
+// subrangeSpec: DOT_DOT expr (after the min expr)
+func (p *parser) subrangeSpec(pos token.Position, min ast.Expr) *ast.SubrangeSpec {
+	p.expect(token.DOT_DOT)
+	max := p.expr()
+	return &ast.SubrangeSpec{Min: min, Max: max, Span: p.span(pos)}
+}
+
+// recordVariant: CASE (IDENT COLON)? typeIdent OF variantCase (SEMICOLON variantCase)* SEMICOLON?
+func (p *parser) recordVariant() *ast.RecordVariant {
+	pos := p.pos
+	p.expect(token.CASE)
+	tag := ""
+	typ := p.typeIdent()
+	if p.tok == token.COLON {
+		p.next()
+		tag = typ.Name
+		typ = p.typeIdent()
+	}
+	p.expect(token.OF)
+	cases := []*ast.VariantCase{p.variantCase()}
+	for p.tok == token.SEMICOLON {
+		p.next()
+		if p.tok == token.END || p.tok == token.RPAREN {
+			break
+		}
+		cases = append(cases, p.variantCase())
+	}
+	return &ast.RecordVariant{Tag: tag, Type: typ, Cases: cases, Span: p.span(pos)}
+}
+
+// variantCase: expr (COMMA expr)* COLON LPAREN fieldList? RPAREN
+// fieldList: identList COLON typeSpec (SEMICOLON identList COLON typeSpec)* (SEMICOLON recordVariant)?
+func (p *parser) variantCase() *ast.VariantCase {
+	pos := p.pos
+	consts := []ast.Expr{p.expr()}
+	for p.tok == token.COMMA {
+		p.next()
+		consts = append(consts, p.expr())
+	}
+	p.expect(token.COLON)
+	p.expect(token.LPAREN)
+	sections := []*ast.RecordSection{}
+	var variant *ast.RecordVariant
+	for p.tok != token.RPAREN {
+		if p.tok == token.CASE {
+			variant = p.recordVariant()
+			break
+		}
+		sectionPos := p.pos
+		names := p.identList()
+		p.expect(token.COLON)
+		typ := p.typeSpec()
+		section := &ast.RecordSection{Names: names, Type: typ, Span: p.span(sectionPos)}
+		sections = append(sections, section)
+		if p.tok != token.SEMICOLON {
+			break
+		}
+		p.next()
+	}
+	p.expect(token.RPAREN)
+	return &ast.VariantCase{Consts: consts, Sections: sections, Variant: variant, Span: p.span(pos)}
+}
+
+// objectSpec: OBJECT (LPAREN typeIdent RPAREN)? recordSection* methodHeading* END
+func (p *parser) objectSpec() *ast.ObjectSpec {
+	pos := p.pos
+	p.expect(token.OBJECT)
+	var parent *ast.TypeIdent
+	if p.tok == token.LPAREN {
+		p.next()
+		parent = p.typeIdent()
+		p.expect(token.RPAREN)
+	}
+	sections := []*ast.RecordSection{}
+	for p.tok == token.IDENT {
+		p.tryItem(func() {
+			sections = append(sections, p.recordSection())
+		})
+	}
+	var methods []ast.DeclPart
+	for p.matches(token.PROCEDURE, token.FUNCTION, token.CONSTRUCTOR, token.DESTRUCTOR) {
+		p.tryItem(func() {
+			methods = append(methods, p.methodHeading())
+		})
+	}
+	p.expect(token.END)
+	return &ast.ObjectSpec{Parent: parent, Sections: sections, Methods: methods, Span: p.span(pos)}
+}
+
+// methodHeading: (PROCEDURE | FUNCTION | CONSTRUCTOR | DESTRUCTOR) heading (VIRTUAL SEMICOLON)?
+func (p *parser) methodHeading() ast.DeclPart {
+	leading := p.leadingComments()
+	pos := p.pos
+	decl := p.declPart(false)
+	// "virtual" is a directive rather than a reserved word
+	if p.tok == token.IDENT && strings.ToLower(p.val) == "virtual" {
+		p.next()
+		p.expect(token.SEMICOLON)
+		switch decl := decl.(type) {
+		case *ast.ProcDecl:
+			decl.Virtual = true
+			decl.Span = p.span(pos)
+		case *ast.FuncDecl:
+			decl.Virtual = true
+			decl.Span = p.span(pos)
+		}
+	}
+	p.addComments(decl, leading, p.trailingComments(decl))
+	return decl
+}
+
+func (p *parser) recordSection() *ast.RecordSection {
+	leading := p.leadingComments()
+	pos := p.pos
+	names := p.identList()
+	p.expect(token.COLON)
+	typ := p.typeSpec()
+	p.expect(token.SEMICOLON)
+	section := &ast.RecordSection{Names: names, Type: typ, Span: p.span(pos)}
+	p.addComments(section, leading, p.trailingComments(section))
+	return section
+}
+
+func (p *parser) compoundStmt() *ast.CompoundStmt {
+	pos := p.pos
+	p.expect(token.BEGIN)
+	stmt := &ast.CompoundStmt{Stmts: p.stmts()}
+	p.addEndComments(stmt)
+	p.expect(token.END)
+	stmt.Span = p.span(pos)
+	return stmt
+}
+
+func (p *parser) stmts() []ast.Stmt {
+	stmts := []ast.Stmt{p.syncStmt()}
+	for {
+		switch {
+		case p.tok == token.SEMICOLON:
+			p.next()
+			last := stmts[len(stmts)-1]
+			p.addComments(last, nil, p.trailingComments(last))
+			stmts = append(stmts, p.syncStmt())
+		case p.matches(stmtSyncTokens...):
+			return stmts
+		case p.matches(token.IDENT, token.AT, token.GOTO, token.BEGIN, token.IF, token.CASE, token.WHILE, token.REPEAT, token.FOR, token.WITH):
+			// Probably a missing semicolon between statements
+			p.addError(p.error("expected %s instead of %s", token.SEMICOLON, p.tok))
+			stmts = append(stmts, p.syncStmt())
+		default:
+			p.addError(p.error("expected %s instead of %s", token.SEMICOLON, p.tok))
+			p.advance()
+			p.sync(stmtSyncTokens...)
+		}
+	}
+}
+
+// Parse a statement, recovering from any error by skipping to the
+// end of the statement and returning an EmptyStmt in its place.
+func (p *parser) syncStmt() ast.Stmt {
+	var stmt ast.Stmt = &ast.EmptyStmt{Span: ast.Span{StartPos: p.pos, EndPos: p.pos}}
+	p.try(func() {
+		stmt = p.stmt()
+	}, stmtSyncTokens...)
+	return stmt
+}
+
+func (p *parser) stmt() ast.Stmt {
+	leading := p.leadingComments()
+	switches := p.scanner.Switches()
+	stmt := p.labelledStmt(true)
+	p.addComments(stmt, leading, p.trailingComments(stmt))
+	p.switches[stmt] = switches
+	return stmt
+}
+
+func (p *parser) labelledStmt(allowLabel bool) ast.Stmt {
+	pos := p.pos
+	switch p.tok {
+	case token.IDENT, token.AT:
+		var convType *ast.TypeIdent
+		ts := strings.ToLower(p.val)
+		if p.tok == token.IDENT && (ts == "char" || ts == "boolean" || ts == "integer" || ts == "real" || ts == "string") {
+			convType = &ast.TypeIdent{Name: p.val}
+			p.next()
+			convType.Span = p.span(pos)
+			p.expect(token.LPAREN)
+		}
+		varExpr := p.varExpr()
+		if convType != nil {
+			p.expect(token.RPAREN)
+		}
+		identExpr, isIdent := varExpr.(*ast.IdentExpr)
+
+		switch p.tok {
+		case token.ASSIGN:
+			p.next()
+			value := p.expr()
+			return &ast.AssignStmt{TypeConv: convType, Var: varExpr, Value: value, Span: p.span(pos)}
+		case token.COLON:
+			if !isIdent || convType != nil {
+				panic(p.error("label must be a simple identifier"))
+			}
+			if !allowLabel {
+				panic(p.error("unexpected label"))
+			}
+			p.next()
+			stmt := p.labelledStmt(false)
+			return &ast.LabelledStmt{Label: identExpr.Name, Stmt: stmt, Span: p.span(pos)}
+		case token.LPAREN:
+			if convType != nil {
+				panic(p.error("can't have type conversion in procedure call"))
+			}
+			p.next()
+			var args []ast.Expr
+			if isIdent && strings.ToLower(identExpr.Name) == "str" {
+				// Special case: Str(expr:width, str);
+				first := p.expr()
+				if p.tok == token.COLON {
+					p.next()
+					width := p.constant()
+					first = &ast.WidthExpr{Expr: first, Width: width, Span: p.span(first.Pos())}
+				}
+				p.expect(token.COMMA)
+				second := p.expr()
+				args = []ast.Expr{first, second}
+			} else {
+				args = p.argList()
+			}
+			p.expect(token.RPAREN)
+			return &ast.ProcStmt{Proc: varExpr, Args: args, Span: p.span(pos)}
+		default:
+			return &ast.ProcStmt{Proc: varExpr, Args: nil, Span: p.span(pos)}
+		}
+	case token.GOTO:
+		p.next()
+		label := p.val
+		p.expect(token.IDENT)
+		return &ast.GotoStmt{Label: label, Span: p.span(pos)}
+	case token.BEGIN:
+		return p.compoundStmt()
+	case token.IF:
+		p.next()
+		cond := p.expr()
+		p.expect(token.THEN)
+		then := p.stmt()
+		var elseStmt ast.Stmt
+		if p.tok == token.ELSE {
+			p.next()
+			elseStmt = p.stmt()
+		}
+		return &ast.IfStmt{Cond: cond, Then: then, Else: elseStmt, Span: p.span(pos)}
+	case token.CASE:
+		p.next()
+		selector := p.expr()
+		p.expect(token.OF)
+		stmt := &ast.CaseStmt{Selector: selector, Cases: []*ast.CaseElement{p.caseElement()}}
+		// Grammar quirkiness here, but this seems to mimic Turbo Pascal
+		for p.tok == token.SEMICOLON || p.tok == token.ELSE {
+			if p.tok == token.SEMICOLON {
+				p.next()
+				last := stmt.Cases[len(stmt.Cases)-1].Stmt
+				p.addComments(last, nil, p.trailingComments(last))
+			}
+			if p.tok == token.END {
+				break
+			}
+			if p.tok == token.ELSE {
+				p.addEndComments(stmt.Cases[len(stmt.Cases)-1])
+				p.next()
+				stmt.Else = p.stmts()
+				break
+			}
+			stmt.Cases = append(stmt.Cases, p.caseElement())
+		}
+		if stmt.Else != nil {
+			p.addEndComments(stmt)
+		} else {
+			p.addEndComments(stmt.Cases[len(stmt.Cases)-1])
+		}
+		p.expect(token.END)
+		stmt.Span = p.span(pos)
+		return stmt
+	case token.WHILE:
+		p.next()
+		cond := p.expr()
+		p.expect(token.DO)
+		stmt := p.stmt()
+		return &ast.WhileStmt{Cond: cond, Stmt: stmt, Span: p.span(pos)}
+	case token.REPEAT:
+		p.next()
+		stmts := p.stmts()
+		p.expect(token.UNTIL)
+		cond := p.expr()
+		return &ast.RepeatStmt{Stmts: stmts, Cond: cond, Span: p.span(pos)}
+	case token.FOR:
+		p.next()
+		identPos := p.pos
+		ident := &ast.IdentExpr{Name: p.val}
+		p.expect(token.IDENT)
+		ident.Span = p.span(identPos)
+		p.expect(token.ASSIGN)
+		initial := p.expr()
+		if p.tok != token.TO && p.tok != token.DOWNTO {
+			panic(p.error("expected 'to' or 'downto'"))
+		}
+		down := p.tok == token.DOWNTO
+		p.next()
+		final := p.expr()
+		p.expect(token.DO)
+		stmt := p.stmt()
+		return &ast.ForStmt{Var: ident, Initial: initial, Down: down, Final: final, Stmt: stmt, Span: p.span(pos)}
+	case token.WITH:
+		p.next()
+		varExpr := p.varExpr()
+		p.expect(token.DO)
+		stmt := p.stmt()
+		return &ast.WithStmt{Var: varExpr, Stmt: stmt, Span: p.span(pos)}
+	default:
+		return &ast.EmptyStmt{Span: ast.Span{StartPos: pos, EndPos: pos}}
+	}
+}
+
+func (p *parser) caseElement() *ast.CaseElement {
+	pos := p.pos
+	consts := []ast.Expr{p.constantOrRange()}
+	for p.tok == token.COMMA {
+		p.next()
+		consts = append(consts, p.constantOrRange())
+	}
+	p.expect(token.COLON)
+	stmt := p.stmt()
+	return &ast.CaseElement{Consts: consts, Stmt: stmt, Span: p.span(pos)}
+}
+
+func (p *parser) constantOrRange() ast.Expr {
+	expr := p.constant()
+	if p.tok == token.DOT_DOT {
+		p.next()
+		max := p.constant()
+		return &ast.RangeExpr{Min: expr, Max: max, Span: p.span(expr.Pos())}
+	}
+	return expr
+}
+
+// setElement: expr (DOT_DOT expr)?
+func (p *parser) setElement() ast.Expr {
+	expr := p.expr()
+	if p.tok == token.DOT_DOT {
+		p.next()
+		max := p.expr()
+		return &ast.RangeExpr{Min: expr, Max: max, Span: p.span(expr.Pos())}
+	}
+	return expr
+}
+
+func (p *parser) constant() ast.Expr {
+	return p.signedFactor()
+}
+
+func (p *parser) constDeclValue() ast.Expr {
+	pos := p.pos
+	switch p.tok {
+	case token.LPAREN:
+		p.next()
+		first := p.constElement(p.constant)
+		if p.tok == token.COLON { // record constant
+			identExpr, isIdent := first.(*ast.IdentExpr)
+			if !isIdent {
+				panic(p.error("expected record field: 'name: value'"))
+			}
+			p.expect(token.COLON)
+			value := p.constElement(p.expr)
+			fields := []*ast.ConstField{{Name: identExpr.Name, Value: value, Span: p.span(first.Pos())}}
+			for p.tok == token.SEMICOLON {
+				p.next()
+				fieldPos := p.pos
+				name := p.val
+				p.expect(token.IDENT)
+				p.expect(token.COLON)
+				value = p.constElement(p.expr)
+				fields = append(fields, &ast.ConstField{Name: name, Value: value, Span: p.span(fieldPos)})
+			}
+			p.expect(token.RPAREN)
+			return &ast.ConstRecordExpr{Fields: fields, Span: p.span(pos)}
+		} else { // array constant
+			consts := []ast.Expr{first}
+			for p.tok == token.COMMA {
+				p.next()
+				consts = append(consts, p.constElement(p.constant))
+			}
+			p.expect(token.RPAREN)
+			return &ast.ConstArrayExpr{Values: consts, Span: p.span(pos)}
+		}
+	default:
+		return p.constant()
+	}
+}
+
+// constElement parses an element of an array or record constant:
+// a nested array or record constant (which starts with a parenthesis,
+// as in ((1, 0), (0, 1))) or a value parsed with parse.
+func (p *parser) constElement(parse func() ast.Expr) ast.Expr {
+	if p.tok == token.LPAREN {
+		return p.constDeclValue()
+	}
+	return parse()
+}
+
+func (p *parser) argList() []ast.Expr {
+	args := []ast.Expr{p.expr()}
+	for p.tok == token.COMMA {
+		p.next()
+		args = append(args, p.expr())
+	}
+	return args
+}
+
+// variable: (AT identifier | identifier) (LBRACKET expression (COMMA expression)* RBRACKET | DOT identifier | POINTER)*
+func (p *parser) varExpr() ast.Expr {
+	pos := p.pos
+	hasAt := false
+	if p.tok == token.AT {
+		p.next()
+		hasAt = true
+	}
+	identPos := p.pos
+	name := p.val
+	p.expect(token.IDENT)
+	var expr ast.Expr = &ast.IdentExpr{Name: name, Span: p.span(identPos)}
+	for p.tok == token.LBRACKET || p.tok == token.DOT || p.tok == token.POINTER {
+		switch p.tok {
+		case token.LBRACKET:
+			// a[i, j] is shorthand for a[i][j]
+			p.next()
+			index := p.expr()
+			expr = &ast.IndexExpr{Array: expr, Index: index, Span: p.span(identPos)}
+			for p.tok == token.COMMA {
+				p.next()
+				index := p.expr()
+				expr = &ast.IndexExpr{Array: expr, Index: index, Span: p.span(identPos)}
+			}
+			p.expect(token.RBRACKET)
+		case token.DOT:
+			p.next()
+			field := p.val
+			p.expect(token.IDENT)
+			expr = &ast.DotExpr{Record: expr, Field: field, Span: p.span(identPos)}
+		case token.POINTER:
+			p.next()
+			expr = &ast.PointerExpr{Expr: expr, Span: p.span(identPos)}
+		}
+	}
+	if hasAt {
+		expr = &ast.AtExpr{Expr: expr, Span: p.span(pos)}
+	}
+	return expr
+}
+
+// expr: simpleExpr (relationalOp simpleExpr)*
+func (p *parser) expr() ast.Expr {
+	return p.binaryExpr(p.simpleExpr, token.EQUALS, token.NOT_EQUALS, token.LESS, token.LTE, token.GREATER, token.GTE, token.IN)
+}
+
+// simpleExpr: term (additiveOp term)*
+func (p *parser) simpleExpr() ast.Expr {
+	return p.binaryExpr(p.term, token.PLUS, token.MINUS, token.OR, token.XOR)
+}
+
+// term: signedFactor (multiplicativeOp signedFactor)*
+func (p *parser) term() ast.Expr {
+	return p.binaryExpr(p.signedFactor, token.STAR, token.SLASH, token.DIV, token.MOD, token.AND, token.SHL, token.SHR)
+}
+
+// signedFactor: (PLUS | MINUS)? factor
+func (p *parser) signedFactor() ast.Expr {
+	if p.tok == token.PLUS || p.tok == token.MINUS {
+		pos := p.pos
+		op := p.tok
+		p.next()
+		expr := p.factor()
+		return &ast.UnaryExpr{Op: op, Expr: expr, Span: p.span(pos)}
+	}
+	return p.factor()
+}
+
+// factor: var | LPAREN expr RPAREN | function | constant | NOT factor | TRUE | FALSE
+func (p *parser) factor() ast.Expr {
+	pos := p.pos
+	switch p.tok {
+	case token.LPAREN:
+		p.next()
+		expr := p.expr()
+		p.expect(token.RPAREN)
+		return &ast.ParenExpr{Expr: expr, Span: p.span(pos)}
+	case token.LBRACKET:
+		p.next()
+		values := []ast.Expr{}
+		if p.tok != token.RBRACKET {
+			values = append(values, p.setElement())
+			for p.tok == token.COMMA {
+				p.next()
+				values = append(values, p.setElement())
+			}
+		}
+		p.expect(token.RBRACKET)
+		return &ast.SetExpr{Values: values, Span: p.span(pos)}
+	case token.NUM:
+		val := p.val
+		p.next()
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				panic(p.error("invalid number: %s", err))
+			}
+			return &ast.ConstExpr{Value: f, IsHex: false, Span: p.span(pos)}
+		}
+		return &ast.ConstExpr{Value: i, IsHex: false, Span: p.span(pos)}
+	case token.HEX:
+		val := p.val
+		p.next()
+		i, err := strconv.ParseInt(val, 16, 64)
+		if err != nil {
+			panic(p.error("invalid hex number: %s", err))
+		}
+		return &ast.ConstExpr{Value: int(i), IsHex: true, Span: p.span(pos)}
+	case token.STR:
+		s := p.val
+		p.next()
+		return &ast.ConstExpr{Value: s, IsHex: false, Span: p.span(pos)}
+	case token.NOT:
+		p.next()
+		expr := p.factor()
+		return &ast.UnaryExpr{Op: token.NOT, Expr: expr, Span: p.span(pos)}
+	case token.TRUE:
+		p.next()
+		return &ast.ConstExpr{Value: true, IsHex: false, Span: p.span(pos)}
+	case token.FALSE:
+		p.next()
+		return &ast.ConstExpr{Value: false, IsHex: false, Span: p.span(pos)}
+	case token.NIL:
+		p.next()
+		return &ast.ConstExpr{Value: nil, IsHex: false, Span: p.span(pos)}
+	case token.IDENT, token.AT:
+		ts := strings.ToLower(p.val)
+		if p.tok == token.IDENT && (ts == "byte" || ts == "char" || ts == "boolean" || ts == "integer" || ts == "word" || ts == "real" || ts == "string") {
+			typ := &ast.TypeIdent{Name: p.val}
+			p.next()
+			typ.Span = p.span(pos)
+			p.expect(token.LPAREN)
+			expr := p.expr()
+			p.expect(token.RPAREN)
+			return &ast.TypeConvExpr{Type: typ, Expr: expr, Span: p.span(pos)}
+		}
+		expr := p.varExpr()
+		if p.tok == token.LPAREN {
+			p.next()
+			args := p.argList()
+			p.expect(token.RPAREN)
+			expr = &ast.FuncExpr{Func: expr, Args: args, Span: p.span(pos)}
+			if p.tok == token.POINTER {
+				p.next()
+				expr = &ast.PointerExpr{Expr: expr, Span: p.span(pos)}
+			}
+		}
+		return expr
+	default:
+		panic(p.error("expected factor"))
+	}
+}
+
+// Parse a left-associative sequence of operands separated by any of
+// the given operators (all of the same precedence level), so that
+// "a - b - c" is parsed as "(a - b) - c".
+func (p *parser) binaryExpr(operand func() ast.Expr, ops ...token.Token) ast.Expr {
+	expr := operand()
+	for p.matches(ops...) {
+		op := p.tok
+		p.next()
+		right := operand()
+		expr = &ast.BinaryExpr{Left: expr, Op: op, Right: right, Span: p.span(expr.Pos())}
+	}
+	return expr
+}
+
+// Call the given parse function. If it fails with a *Error,
+// record the error and skip tokens until one of syncTokens (or EOF) so
+// parsing can continue after the error. Return true iff f succeeded.
+func (p *parser) try(f func(), syncTokens ...token.Token) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			// Record Error or re-panic
+			p.addError(r.(*Error))
+			p.sync(syncTokens...)
+		}
+	}()
+	f()
+	return true
+}
+
+// Like try, but for an item in a declaration list or record, which
+// is terminated by a semicolon: on error, skip past the semicolon.
+func (p *parser) tryItem(f func()) {
+	syncTokens := append([]token.Token{token.SEMICOLON, token.END}, declSyncTokens...)
+	if !p.try(f, syncTokens...) && p.tok == token.SEMICOLON {
+		p.advance()
+	}
+}
+
+// Skip tokens until the current token is one of the given tokens or
+// EOF. Errors from illegal tokens are recorded rather than panicking.
+func (p *parser) sync(tokens ...token.Token) {
+	for !p.matches(tokens...) && p.tok != token.EOF {
+		p.advance()
+	}
+}
+
+// Like next, but record an ILLEGAL token error instead of panicking.
+func (p *parser) advance() {
+	p.scan()
+	if p.tok == token.ILLEGAL {
+		p.addError(p.error("%s", p.val))
+	}
+}
+
+// Record given parse error, unless it's at the same position as the
+// previous error (a cascade from an error we've already reported).
+func (p *parser) addError(err *Error) {
+	if len(p.errors) > 0 && p.errors[len(p.errors)-1].Position == err.Position {
+		return
+	}
+	p.errors = append(p.errors, err)
+}
+
+// Parse next token into p.tok (and set p.pos and p.val).
+func (p *parser) next() {
+	p.scan()
+	if p.tok == token.ILLEGAL {
+		panic(p.error("%s", p.val))
+	}
+}
+
+// Scan the next token other than a compiler directive into p.tok,
+// recording any directives skipped along the way.
+func (p *parser) scan() {
+	p.end = p.scanner.EndPos()
+	for {
+		p.pos, p.tok, p.val = p.scanner.Scan()
+		if p.tok != token.DIRECTIVE {
+			return
+		}
+		p.directives = append(p.directives, &ast.Directive{Span: ast.Span{StartPos: p.pos, EndPos: p.scanner.EndPos()}, Text: p.val})
+	}
+}
+
+// Set the Directives field of the given file (which may be nil).
+func setDirectives(file ast.File, directives []*ast.Directive) {
+	switch file := file.(type) {
+	case *ast.Program:
+		file.Directives = directives
+	case *ast.Unit:
+		file.Directives = directives
+	}
+}
+
+// Ensure current token is tok, and parse next token into p.tok.
+func (p *parser) expect(tok token.Token) {
+	if p.tok != tok {
+		panic(p.error("expected %s instead of %s", tok, p.tok))
+	}
+	p.next()
+}
+
+// Return true iff current token matches one of the given operators,
+// but don't parse next token.
+func (p *parser) matches(operators ...token.Token) bool {
+	for _, operator := range operators {
+		if p.tok == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// Take the comments scanned since the last call, stopping at the first
+// comment for which keep returns false.
+func (p *parser) takeComments(keep func(c *token.Comment) bool) []*token.Comment {
+	comments := p.scanner.Comments()
+	start := p.numComments
+	for p.numComments < len(comments) && keep(comments[p.numComments]) {
+		p.numComments++
+	}
+	return comments[start:p.numComments]
+}
+
+// Take the comments before the current token, to attach to the node
+// that starts with it.
+func (p *parser) leadingComments() []*token.Comment {
+	return p.takeComments(func(c *token.Comment) bool {
+		// Comments in another (included) file were scanned earlier
+		return c.Pos().Filename != p.pos.Filename || c.Pos().Offset < p.pos.Offset
+	})
+}
+
+// Take the comments inside the given (just-parsed) node, or after it
+// on the same line as its end.
+func (p *parser) trailingComments(node ast.Node) []*token.Comment {
+	end := node.End()
+	return p.takeComments(func(c *token.Comment) bool {
+		return c.Pos().Filename == end.Filename &&
+			(c.Pos().Offset < end.Offset || c.Pos().Line == end.Line)
+	})
+}
+
+// Attach the given leading and trailing comments to node.
+func (p *parser) addComments(node ast.Node, leading, trailing []*token.Comment) {
+	if len(leading) == 0 && len(trailing) == 0 {
+		return
+	}
+	comments := p.comments[node]
+	if comments == nil {
+		comments = &ast.Comments{}
+		p.comments[node] = comments
+	}
+	comments.Leading = append(comments.Leading, leading...)
+	comments.Trailing = append(comments.Trailing, trailing...)
+}
+
+// Attach the comments before the current token, which ends a block
+// (or the file), to node as its end-of-block comments.
+func (p *parser) addEndComments(node ast.Node) {
+	end := p.leadingComments()
+	if len(end) == 0 {
+		return
+	}
+	comments := p.comments[node]
+	if comments == nil {
+		comments = &ast.Comments{}
+		p.comments[node] = comments
+	}
+	comments.End = append(comments.End, end...)
+}
+
+// Return a Span from start to the end of the last token parsed.
+func (p *parser) span(start token.Position) ast.Span {
+	return ast.Span{StartPos: start, EndPos: p.end}
+}
+
+// Format given string and args with Sprintf and return *Error
+// with that message and the current position.
+func (p *parser) error(format string, args ...interface{}) *Error {
+	message := fmt.Sprintf(format, args...)
+	return &Error{p.pos, message}
+}
@@ -0,0 +1,47 @@
+package token
+
+// Comment is a single { ... }, (* ... *), or // comment in the source.
+type Comment struct {
+	StartPos Position // start of the opening delimiter
+	EndPos   Position // just past the end of the closing delimiter
+	Text     string   // text between the comment delimiters
+}
+
+// Pos returns the position of the start of the comment.
+func (c *Comment) Pos() Position {
+	return c.StartPos
+}
+
+// End returns the position just past the end of the comment.
+func (c *Comment) End() Position {
+	return c.EndPos
+}
+
+// Switches is the state of the single-letter switch directives like
+// {$I-} and {$R+}: bit n is set if the switch 'A'+n is on.
+type Switches uint32
+
+// DefaultSwitches is the Turbo Pascal 5.5 default switch state,
+// {$A+,B-,D+,E+,F-,I+,L+,N-,O-,R-,S+,V+}.
+const DefaultSwitches Switches = 1<<('A'-'A') | 1<<('D'-'A') | 1<<('E'-'A') |
+	1<<('I'-'A') | 1<<('L'-'A') | 1<<('S'-'A') | 1<<('V'-'A')
+
+// On returns true if the switch with the given letter is on.
+func (s Switches) On(letter byte) bool {
+	return s&switchBit(letter) != 0
+}
+
+// Set returns a copy of s with the given switch turned on or off.
+func (s Switches) Set(letter byte, on bool) Switches {
+	if on {
+		return s | switchBit(letter)
+	}
+	return s &^ switchBit(letter)
+}
+
+func switchBit(letter byte) Switches {
+	if letter >= 'a' && letter <= 'z' {
+		letter -= 'a' - 'A'
+	}
+	return 1 << (letter - 'A')
+}
@@ -1,11 +1,26 @@
-// Turbo Pascal lexer tokens
-
-package main
+// Package token defines the Turbo Pascal lexer tokens, source
+// positions, comments, and switch directive state.
+package token
 
 import (
 	"strings"
 )
 
+// Position stores the source file, line, and column where a token
+// starts.
+type Position struct {
+	// Name of the source file the token is in (empty if the source
+	// didn't come from a named file).
+	Filename string `json:"filename,omitempty"`
+	// Line number of the token (starts at 1).
+	Line int `json:"line"`
+	// Column on the line (starts at 1). Note that this is the byte
+	// offset into the line, not rune offset.
+	Column int `json:"column"`
+	// Byte offset into the source (starts at 0).
+	Offset int `json:"offset"`
+}
+
 // Token is the type of a single token.
 type Token int
 
@@ -43,6 +58,8 @@ const (
 	BEGIN
 	CASE
 	CONST
+	CONSTRUCTOR
+	DESTRUCTOR
 	DIV
 	DO
 	DOWNTO
@@ -63,12 +80,14 @@ const (
 	MOD
 	NIL
 	NOT
+	OBJECT
 	OF
 	OR
 	PROCEDURE
 	PROGRAM
 	RECORD
 	REPEAT
+	SET
 	SHL
 	SHR
 	THEN
@@ -88,6 +107,9 @@ const (
 	NUM
 	HEX
 	STR
+
+	// Compiler directive: {$...}
+	DIRECTIVE
 )
 
 var keywordTokens = map[string]Token{
@@ -96,6 +118,8 @@ var keywordTokens = map[string]Token{
 	"BEGIN":          BEGIN,
 	"CASE":           CASE,
 	"CONST":          CONST,
+	"CONSTRUCTOR":    CONSTRUCTOR,
+	"DESTRUCTOR":     DESTRUCTOR,
 	"DIV":            DIV,
 	"DO":             DO,
 	"DOWNTO":         DOWNTO,
@@ -116,12 +140,14 @@ var keywordTokens = map[string]Token{
 	"MOD":            MOD,
 	"NIL":            NIL,
 	"NOT":            NOT,
+	"OBJECT":         OBJECT,
 	"OF":             OF,
 	"OR":             OR,
 	"PROCEDURE":      PROCEDURE,
 	"PROGRAM":        PROGRAM,
 	"RECORD":         RECORD,
 	"REPEAT":         REPEAT,
+	"SET":            SET,
 	"SHL":            SHL,
 	"SHR":            SHR,
 	"THEN":           THEN,
@@ -175,6 +201,8 @@ var tokenNames = map[Token]string{
 	BEGIN:          "BEGIN",
 	CASE:           "CASE",
 	CONST:          "CONST",
+	CONSTRUCTOR:    "CONSTRUCTOR",
+	DESTRUCTOR:     "DESTRUCTOR",
 	DIV:            "DIV",
 	DO:             "DO",
 	DOWNTO:         "DOWNTO",
@@ -195,12 +223,14 @@ var tokenNames = map[Token]string{
 	MOD:            "MOD",
 	NIL:            "NIL",
 	NOT:            "NOT",
+	OBJECT:         "OBJECT",
 	OF:             "OF",
 	OR:             "OR",
 	PROCEDURE:      "PROCEDURE",
 	PROGRAM:        "PROGRAM",
 	RECORD:         "RECORD",
 	REPEAT:         "REPEAT",
+	SET:            "SET",
 	SHL:            "SHL",
 	SHR:            "SHR",
 	THEN:           "THEN",
@@ -219,9 +249,17 @@ var tokenNames = map[Token]string{
 	NUM:   "NUM",
 	HEX:   "HEX",
 	STR:   "STR",
+
+	DIRECTIVE: "DIRECTIVE",
 }
 
 // String returns the string name of this token.
 func (t Token) String() string {
 	return tokenNames[t]
 }
+
+// MarshalText implements encoding.TextMarshaler so that tokens are
+// encoded in JSON by name, for example "IDENT".
+func (t Token) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
@@ -0,0 +1,49 @@
+#!/usr/bin/env bash
+
+# Check the regression corpus in testdata. For each program in
+# testdata/orig (converted as Delphi if it's a .DPR file), the parser's
+# output (or errors) must match the file in testdata/parsed. If there's
+# a testdata/converted/NAME.go, the converted Go code must match it
+# (converted with the flags in NAME.flags, if any), and any convert
+# errors must match NAME.err; the Go code is then run with the runtime
+# in converted/lib.go (and the program's external routines, written in
+# Go in testdata/external/NAME.go), and its output must match
+# testdata/output/NAME.txt.
+
+go build || exit 1
+status=0
+tmp=$(mktemp -d)
+trap 'rm -rf $tmp' EXIT
+cp converted/lib.go $tmp/
+printf 'module corpus\n\ngo 1.16\n' > $tmp/go.mod
+for path in testdata/orig/*.PAS testdata/orig/*.DPR; do
+    file=$(basename $path)
+    name=${file%.*}
+    dialect=tp
+    if [ ${file##*.} = DPR ]; then
+        dialect=delphi
+    fi
+    ./pas2go parse -dialect $dialect $path 2>&1 | diff -u testdata/parsed/$file - || status=1
+
+    converted=testdata/converted/$name.go
+    if [ ! -f $converted ]; then
+        continue
+    fi
+    flags=
+    if [ -f testdata/converted/$name.flags ]; then
+        flags=$(cat testdata/converted/$name.flags)
+    fi
+    ./pas2go convert -dialect $dialect $flags $path 2>$tmp/errors | gofmt -r '(a) -> a' -s >$tmp/main.go
+    diff -u $converted $tmp/main.go || status=1
+    errors=testdata/converted/$name.err
+    if [ ! -f $errors ]; then
+        errors=/dev/null
+    fi
+    diff -u $errors $tmp/errors || status=1
+    rm -f $tmp/external.go
+    if [ -f testdata/external/$name.go ]; then
+        cp testdata/external/$name.go $tmp/external.go
+    fi
+    (cd $tmp && go run .) 2>&1 | diff -u testdata/output/$name.txt - || status=1
+done
+exit $status
@@ -0,0 +1,61 @@
+// Operator precedence and associativity: additive, multiplicative,
+// logical, and relational operators, and unary minus.
+package main
+
+var (
+	a, b, c, x int16
+	f          float64
+	ok         bool
+	w          uint16
+	l          int32
+	s          string
+	ch         byte
+)
+
+func main() {
+	a = 7
+	b = 3
+	c = 2
+	x = 5
+	// Additive operators are left-associative
+	x = a - b - c
+	x = a - b + c
+	x = a + b - c
+	x = a - (b - c)
+	// Multiplicative operators are left-associative
+	x = x / 2 * 3
+	x = x * 2 / 3
+	x = x % 4 / 2
+	x = x / (2 * 3)
+	f = float64(a) / float64(b) / float64(c)
+	x = a << 2 >> 1
+	// Multiplicative operators bind more tightly than additive
+	x = a + b*c
+	x = a*b + c
+	x = a - b*c - x
+	x = a*b - c*x
+	x = a*100/3 - b
+	// Unary minus applies to the first factor only
+	x = -a - b
+	x = -a * b
+	// Logical and bitwise operators follow the same levels
+	x = a | b&c
+	x = a&b | c ^ x
+	ok = a == b && b == c || c == x
+	// Relational operators bind least tightly
+	ok = a+b == c-x
+	ok = a*b <= c/x
+	WriteLn(x, " ", f, " ", ok)
+	// Mixed word and integer operands are promoted to longint
+	w = 65535
+	l = int32(w) + 1
+	l = l + int32(w) - int32(a)
+	WriteLn(l)
+	// Only "v := v + a" is written as an assignment operator
+	x += a
+	x = x + a + b
+	s = "a"
+	ch = 'b'
+	s = s + string([]byte{ch}) + "x"
+	WriteLn(x, " ", s)
+}
@@ -0,0 +1,45 @@
+// The three comment styles, comment-like text inside comments and
+// strings, switch directives written as comments, and comments at the
+// ends of blocks, case elements, and the file.
+package main
+
+// This comment contains { braces } and another "(*"
+var (
+	x int16 // trailing comment
+	s string
+)
+
+func Count(n int16) {
+	switch n {
+	case 0:
+		WriteLn("none") // nothing
+	case 1:
+		WriteLn("one")
+	// just the one
+	default:
+		WriteLn("many")
+		// or more
+	}
+	x += n
+	// counted
+}
+
+func Done() {
+	WriteLn("done")
+}
+
+func main() {
+	x = (x + 1) * 2 // parens next to a star: ( *
+	x++
+	s = "(* not a comment *)"
+	x = x * x
+	WriteLn(x, " ", s)
+	// Multi-line comment
+	x = 0
+	Count(0)
+	Count(2)
+	Done()
+	// the last statement
+}
+
+// After the end of the program
@@ -0,0 +1,12 @@
+// Conditional compilation: $DEFINE, $UNDEF, $IFDEF, $IFNDEF, $IFOPT,
+// and $ELSE, including branches nested inside untaken ones.
+package main
+
+var mode int16
+
+func main() {
+	mode = 1
+	mode = 5
+	mode = 7
+	WriteLn(mode)
+}
@@ -0,0 +1,30 @@
+// Delphi's dialect: // comments, and the implicit Result variable,
+// including a function's result assigned in a nested function that
+// has its own Result.
+package main
+
+// Result and the function's name are the same variable
+func Twice(n int16) (Result int16) {
+	Result = n
+	Result = Result * 2
+	return
+}
+
+func Outer(n int16) (OuterResult int16) {
+	var Inner func(k int16) int16
+	// Assigns both its own Result and the enclosing function's
+	Inner = func(k int16) (Result int16) {
+		Result = k + 1
+		OuterResult = Result * 10
+		return
+	}
+
+	if Inner(n) > 100 {
+		OuterResult = 0
+	}
+	return
+}
+
+func main() {
+	WriteLn(Twice(5), " ", Outer(2))
+}
@@ -0,0 +1,84 @@
+// Forward declarations of procedures and functions, with and without
+// their parameters repeated, and external and inline declarations.
+package main
+
+var total int16
+
+// Mutual recursion needs one of the pair declared ahead
+func IsOdd(n int16) (IsOdd bool) {
+	if n == 0 {
+		IsOdd = false
+	} else {
+		IsOdd = IsEven(n - 1)
+	}
+	return
+}
+
+// Parameters and result type are omitted in the definition
+func IsEven(n int16) (IsEven bool) {
+	if n == 0 {
+		IsEven = true
+	} else {
+		IsEven = IsOdd(n - 1)
+	}
+	return
+}
+
+func AddTwice(amount int16) {
+	Add(amount)
+	Add(amount)
+}
+
+func Add(amount int16) {
+	total += amount
+}
+
+func Tally(count int16) {
+	var Step func(i int16)
+	var i int16
+	Twice := func(i int16) {
+		Step(i)
+		Step(i)
+	}
+
+	Step = func(i int16) {
+		total += i
+	}
+
+	for i = 1; i <= count; i++ {
+		Twice(i)
+	}
+}
+
+// CheckSum is external (implemented in assembly or another
+// language), so it must be written in Go in another file of
+// this package, alongside the runtime in lib.go:
+//
+//	func CheckSum(buf *int16, size uint16) uint16
+
+// DisableInterrupts was inline machine code: $FA
+func DisableInterrupts() {
+	panic("TODO: procedure DisableInterrupts")
+}
+
+// Beep was inline machine code: $58/$E6/$42/-1
+func Beep(freq uint16) {
+	panic("TODO: procedure Beep")
+}
+
+// Not called, as the inline routines are only stubs in the Go code
+func Chirp() {
+	DisableInterrupts()
+	Beep(CheckSum(&total, 2))
+}
+
+func main() {
+	total = 0
+	AddTwice(3)
+	Tally(4)
+	if IsEven(total) {
+		WriteLn("even ", total)
+	}
+	// The external routine is written in Go, in testdata/external
+	WriteLn(CheckSum(&total, 2))
+}
@@ -0,0 +1,131 @@
+// Gotos into if branches, loops, case elements, and begin/end blocks,
+// which Go doesn't allow, and a forward goto over a "with" statement
+// that needs a pointer variable.
+package main
+
+type TPoint struct {
+	x, y int16
+}
+
+var (
+	points [4]TPoint
+	total  int16
+)
+
+// Jumps back into an else branch, as OopFindLabel does in ZZT
+func FindFrom(start, target int16) (FindFrom int16) {
+	var i int16
+	if !(start <= 0) {
+		goto ifElse1
+	}
+	FindFrom = -1
+	return
+ifElse1:
+	i = start
+FindNext:
+	i++
+
+	if i < 10 && i%target != 0 {
+		goto FindNext
+	}
+	FindFrom = i
+	return
+}
+
+// Jumps into loops and a case element
+func Loops(n int16) {
+	var i, count int16
+	count = 0
+	if n > 5 {
+		goto Middle
+	}
+while1:
+	if !(count < n) {
+		goto whileEnd1
+	}
+	count++
+Middle:
+	total++
+
+	goto while1
+whileEnd1:
+	if count == 0 {
+		goto Counted
+	}
+	i = 1
+for2:
+	if i > n {
+		goto forEnd2
+	}
+	total += i
+Counted:
+	count++
+
+	i++
+	goto for2
+forEnd2:
+repeat3:
+	n--
+Again:
+	total++
+
+	if !(n <= 0) {
+		goto repeat3
+	}
+	if total < 50 {
+		goto Again
+	}
+	switch count {
+	case 1:
+		goto case4_0
+	case 2:
+		goto case4_1
+	default:
+		goto caseElse4
+	}
+case4_0:
+	WriteLn("one")
+	goto caseEnd4
+case4_1:
+Other:
+	WriteLn("two or more")
+
+	goto caseEnd4
+caseElse4:
+	if count < 10 {
+		goto Other
+	}
+	WriteLn("lots")
+caseEnd4:
+	if total > 100 {
+		goto Done
+	}
+	total = total * 2
+Done:
+	WriteLn(total)
+
+}
+
+// Jumps over a "with" statement that needs a pointer variable
+func Shift(index, dx int16) {
+	if dx == 0 {
+		goto Skip
+	}
+	{
+		point := &points[index-1]
+		point.x += dx
+		point.y += dx
+	}
+Skip:
+	WriteLn(points[index-1].x, " ", points[index-1].y)
+
+}
+
+func main() {
+	total = 0
+	WriteLn(FindFrom(3, 7), " ", FindFrom(0, 7), " ", FindFrom(4, 20))
+	Loops(3)
+	Loops(7)
+	Shift(2, 5)
+	Shift(3, 0)
+}
@@ -0,0 +1,14 @@
+// Include files for declarations and statements, with the include
+// file name in a different case.
+package main
+
+// Declarations included by INCLUDE.PAS
+var x int16
+
+func main() {
+	x = 1
+	// Statements included by INCLUDE.PAS
+	x = 2
+	WriteLn(x)
+	x = 3
+}
@@ -0,0 +1,11 @@
+// A program using a unit that isn't available, so the names it
+// declares are undeclared, and a checker error that doesn't stop the
+// conversion.
+package main
+
+// uses: Crt
+
+func main() {
+	Delay(0)
+	WriteLn("converted")
+}
@@ -0,0 +1,38 @@
+// Multi-dimensional arrays with integer, negative, and enumerated
+// index ranges, indexed as a[i, j] and as a[i][j].
+package main
+
+type (
+	TColor   uint8
+	TGrid    [10][20]byte
+	TCube    [2][2][3]int16
+	TPalette [3][3]byte
+)
+
+const (
+	Red TColor = iota + 1
+	Green
+	Blue
+)
+
+var Identity [2][2]int16 = [2][2]int16{{1, 0}, {0, 1}}
+var (
+	grid    TGrid
+	cube    TCube
+	palette TPalette
+	rows    [3][4]byte
+	x, y    int16
+)
+
+func main() {
+	for y = 1; y <= 10; y++ {
+		for x = 1; x <= 20; x++ {
+			grid[y-1][x-1] = byte(x + y)
+		}
+	}
+	grid[0][1] = grid[1][0]
+	cube[1][1][0] = Identity[1][1]
+	palette[Green-1][2] = 255
+	rows[0][3] = 'x'
+	WriteLn(grid[0][1], " ", grid[9][19], " ", cube[1][1][0], " ", palette[Green-1][2], " ", Chr(rows[0][3]))
+}
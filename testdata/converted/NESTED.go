@@ -0,0 +1,88 @@
+// Recursive and mutually recursive nested procedures and functions,
+// which need declaring before their Go closures are defined.
+package main
+
+const Size = 8
+
+type TGrid [Size][Size]byte
+
+var (
+	grid   TGrid
+	filled int16
+)
+
+func FloodFill(startX, startY int16, fill byte) {
+	var Fill func(x, y int16)
+	var target byte
+	// Calls itself: captures target and fill from the enclosing scope
+	Fill = func(x, y int16) {
+		if x < 1 || x > Size || y < 1 || y > Size {
+			return
+		}
+		if grid[x-1][y-1] != target {
+			return
+		}
+		grid[x-1][y-1] = fill
+		filled++
+		Fill(x-1, y)
+		Fill(x+1, y)
+		Fill(x, y-1)
+		Fill(x, y+1)
+	}
+
+	target = grid[startX-1][startY-1]
+	if target != fill {
+		Fill(startX, startY)
+	}
+}
+
+func Evaluate(depth int16) (Evaluate int16) {
+	var OddSum func(n int16) int16
+	var calls int16
+	// Mutually recursive with OddSum, which is defined after it
+	EvenSum := func(n int16) (EvenSum int16) {
+		calls++
+		if n == 0 {
+			EvenSum = 0
+		} else {
+			EvenSum = OddSum(n-1) + 2
+		}
+		return
+	}
+
+	OddSum = func(n int16) (OddSum int16) {
+		calls++
+		if n == 0 {
+			OddSum = 1
+		} else {
+			OddSum = EvenSum(n-1) + 2
+		}
+		return
+	}
+
+	// Calls an earlier sibling only, so needs no predeclaration
+	Twice := func(n int16) (Twice int16) {
+		Twice = EvenSum(n) * 2
+		return
+	}
+
+	calls = 0
+	Evaluate = Twice(depth) + calls
+	return
+}
+
+var x, y int16
+
+func main() {
+	for x = 1; x <= Size; x++ {
+		for y = 1; y <= Size; y++ {
+			grid[x-1][y-1] = '.'
+		}
+	}
+	for x = 1; x <= Size; x++ {
+		grid[x-1][3] = '#'
+	}
+	filled = 0
+	FloodFill(1, 1, '*')
+	WriteLn(filled, " ", Evaluate(5))
+}
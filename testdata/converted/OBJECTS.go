@@ -0,0 +1,181 @@
+// Turbo Pascal 5.5 objects: fields, static and virtual methods,
+// constructors and destructors, New and Dispose, and virtual calls
+// through a pointer to an ancestor type.
+package main
+
+type (
+	PShape = *TShape
+	TShape struct {
+		vmt  TShapeVMT
+		X, Y int16
+	}
+	PRect = *TRect
+	TRect struct {
+		TShape
+		Width, Height int16
+	}
+	PSquare = *TSquare
+	TSquare struct {
+		TRect
+	}
+	TCounter struct {
+		Count int16
+	}
+)
+type TShapeVMT interface {
+	Done()
+	Area() int16
+}
+
+func (self *TShape) Init(ax, ay int16) {
+	self.vmt = self
+	self.initBody(ax, ay)
+}
+
+func NewTShape(ax, ay int16) *TShape {
+	self := new(TShape)
+	self.Init(ax, ay)
+	return self
+}
+
+type TRectVMT interface {
+	TShapeVMT
+	Perimeter() int16
+}
+
+func (self *TRect) Init(ax, ay, aw, ah int16) {
+	self.vmt = self
+	self.initBody(ax, ay, aw, ah)
+}
+
+func NewTRect(ax, ay, aw, ah int16) *TRect {
+	self := new(TRect)
+	self.Init(ax, ay, aw, ah)
+	return self
+}
+
+func (self *TSquare) Init(ax, ay, side int16) {
+	self.vmt = self
+	self.initBody(ax, ay, side)
+}
+
+func NewTSquare(ax, ay, side int16) *TSquare {
+	self := new(TSquare)
+	self.Init(ax, ay, side)
+	return self
+}
+
+func (self *TShape) initBody(ax, ay int16) {
+	self.X = ax
+	self.Y = ay
+}
+
+func (self *TShape) Done() {
+	WriteLn("done at ", self.X, ",", self.Y)
+}
+
+func (self *TShape) Area() (Area int16) {
+	Area = 0
+	return
+}
+
+func (self *TShape) MoveBy(dx, dy int16) {
+	self.X += dx
+	self.Y += dy
+}
+
+func (self *TShape) Describe() {
+	WriteLn("shape at ", self.X, ",", self.Y, " area ", self.vmt.Area())
+}
+
+func (self *TRect) initBody(ax, ay, aw, ah int16) {
+	self.TShape.initBody(ax, ay)
+	self.Width = aw
+	self.Height = ah
+}
+
+func (self *TRect) Area() (Area int16) {
+	Area = self.Width * self.Height
+	return
+}
+
+func (self *TRect) Perimeter() (Perimeter int16) {
+	Perimeter = 2 * (self.Width + self.Height)
+	return
+}
+
+func (self *TSquare) initBody(ax, ay, side int16) {
+	self.TRect.initBody(ax, ay, side, side)
+}
+
+func (self *TSquare) Perimeter() (Perimeter int16) {
+	Perimeter = 4 * self.Width
+	return
+}
+
+func (self *TCounter) Incr() {
+	self.Count++
+}
+
+func (self *TCounter) Value() (Value int16) {
+	Value = self.Count
+	return
+}
+
+func Grow(shape *TShape) {
+	shape.MoveBy(-1, -1)
+}
+
+func Show(shape TShape) {
+	shape.vmt = &shape
+	shape.X = 0
+	shape.Describe()
+}
+
+func CopyShape(shape *TShape, from TShape) {
+	from.vmt = &from
+	*shape = from
+	shape.vmt = shape
+}
+
+var (
+	shape, other TShape
+	rect, twin   TRect
+	square       PSquare
+	p            PShape
+	counter      TCounter
+)
+
+func main() {
+	shape.Init(1, 2)
+	rect.Init(3, 4, 5, 6)
+	rect.MoveBy(1, 1)
+	rect.Describe()
+	Grow(&rect.TShape)
+	WriteLn(rect.X, ",", rect.Y, " perimeter ", rect.vmt.(TRectVMT).Perimeter())
+	p = &rect.TShape
+	WriteLn(p.vmt.Area())
+	square = NewTSquare(0, 0, 3)
+	p = &square.TShape
+	p.Describe()
+	WriteLn(square.vmt.(TRectVMT).Perimeter())
+	p.vmt.Done()
+	Dispose(p)
+	shape.MoveBy(10, 10)
+	shape.Describe()
+	counter.Count = 0
+	counter.Incr()
+	counter.Incr()
+	WriteLn(counter.Value())
+	// Copies of objects call their own virtual methods
+	twin = rect
+	twin.vmt = &twin
+	twin.Width = 10
+	twin.Describe()
+	rect.Describe()
+	Show(shape)
+	shape.Describe()
+	CopyShape(&other, shape)
+	other.X = 1
+	other.Describe()
+}
@@ -0,0 +1,101 @@
+// Function results: a function's name is its result when assigned
+// to, and a recursive call elsewhere, including in methods and in
+// nested procedures, and nested procedures with their own variable
+// named result.
+package main
+
+type TCounter struct {
+	Count int16
+}
+
+var (
+	depth   int16
+	counter TCounter
+)
+
+func Square(n int16) (result int32) {
+	if n == 0 {
+		result = 0
+	} else {
+		result = Square(n-1) + int32(2*n) - 1
+	}
+	return
+}
+
+// Not recursive, so the Go result keeps the function's name
+func Half(n int16) (Half int16) {
+	Half = n / 2
+	return
+}
+
+func Factorial(n int16) (result int32) {
+	if n <= 1 {
+		result = 1
+	} else {
+		result = int32(n) * Factorial(n-1)
+	}
+	return
+}
+
+// Without parameters, the bare name on the right is a recursive call
+func NextDepth() (result int16) {
+	depth++
+	if depth < 5 {
+		result = NextDepth() + 1
+	} else {
+		result = 0
+	}
+	return
+}
+
+func Digits(n int32) (Digits int16) {
+	var Count func(n int32)
+	var result int16
+	// Assigns the enclosing function's result
+	Count = func(n int32) {
+		result++
+		if n >= 10 {
+			Count(n / 10)
+		} else {
+			Digits = result
+		}
+	}
+
+	result = 0
+	Count(n)
+	return
+}
+
+// Recursive, but a nested procedure declares a variable named result,
+// so that can't be the Go result's name
+func SumSquares(n int16) (SumSquaresResult int16) {
+	Add := func() {
+		var result int16
+		result = n*n + SumSquares(n-1)
+		SumSquaresResult = result
+	}
+
+	if n == 0 {
+		SumSquaresResult = 0
+	} else {
+		Add()
+	}
+	return
+}
+
+func (self *TCounter) Countdown(n int16) (Countdown int16) {
+	self.Count++
+	if n == 0 {
+		Countdown = self.Count
+	} else {
+		Countdown = self.Countdown(n - 1)
+	}
+	return
+}
+
+func main() {
+	depth = 0
+	counter.Count = 0
+	WriteLn(Square(7), " ", Half(9), " ", Factorial(10), " ", NextDepth())
+	WriteLn(Digits(12345), " ", counter.Countdown(3), " ", SumSquares(3))
+}
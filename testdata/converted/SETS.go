@@ -0,0 +1,53 @@
+// Set types, constructors with ranges and non-constant elements, and
+// the set operators, membership, and Include and Exclude.
+package main
+
+type (
+	TColor   uint8
+	TColors  = Set
+	TCharSet = Set
+)
+
+const (
+	Red TColor = iota + 1
+	Green
+	Blue
+)
+
+var (
+	Digits TCharSet = SetOf().WithRange('0', '9')
+	Vowels          = SetOf('a', 'e', 'i', 'o', 'u')
+)
+var (
+	colors TColors
+	chars  Set
+	bytes  Set
+	c      byte
+	i      int16
+	ok     bool
+)
+
+func main() {
+	i = 5
+	c = 'b'
+	// Constructors, including empty sets and non-constant elements
+	colors = SetOf()
+	colors = SetOf(int(Red), int(Blue))
+	bytes = SetOf(int(i), int(i+1)).WithRange(10, 20).WithRange(int(i*2), int(i*3))
+	// Union, difference, and intersection
+	chars = Digits.Union(SetOf().WithRange('a', 'f'))
+	chars = chars.Diff(Vowels)
+	chars = chars.Intersect(SetOf('a').WithRange('0', '9'))
+	colors = colors.Union(SetOf(int(Green)))
+	// Membership, equality, and subset tests
+	ok = chars.Contains(int(c))
+	ok = c >= 'a' && c <= 'z' || c == '_'
+	ok = false
+	ok = chars == SetOf()
+	ok = chars != Digits
+	ok = Digits.SubsetOf(chars)
+	ok = Digits.SubsetOf(chars)
+	colors.Include(int(Green))
+	bytes.Exclude(int(i))
+	WriteLn(ok, " ", chars.Contains(int(c)), " ", bytes.Contains(15), " ", bytes.Contains(int(i)), " ", colors.Contains(int(Green)))
+}
@@ -0,0 +1,72 @@
+// Subrange types of integers, chars, and enumerations, range checked
+// assignments in a $R+ region, and arrays indexed by subranges.
+package main
+
+const MaxStat = 150
+
+type (
+	TIndex  = int8
+	TSigned = int8
+	TLetter = byte
+	TColor  uint8
+	TBright = TColor
+	TStats  [MaxStat + 1]byte
+	TBoard  [60]int16
+	TCounts [26]int16
+	TLevels [5]byte
+	TChars  [256]bool
+)
+
+const (
+	Black TColor = iota + 1
+	Red
+	Green
+	Blue
+	White
+)
+
+var (
+	board  TBoard
+	counts TCounts
+	levels TLevels
+	chars  TChars
+	ix     TIndex
+	delta  TSigned
+	color  TBright
+	level  byte
+	i      int16
+	w      uint16
+	letter TLetter
+	digit  byte
+)
+
+func SetCell(index TIndex, value int16) {
+	board[index-1] = value
+}
+
+func main() {
+	ix = 1
+	i = 60
+	delta = 5
+	color = Green
+	// Range checked assignments and arguments
+	ix = int8(RangeCheck(int64(i), 1, 60))
+	ix = int8(RangeCheck(int64(delta), 1, 60))
+	level = byte(RangeCheck(int64(int16(ix)+1), 0, 255))
+	color = TColor(RangeCheck(int64(Blue), 2, 4))
+	SetCell(int8(RangeCheck(int64(i), 1, 60)), 0)
+	w = 1
+	i = int16(RangeCheck(int64(int32(w)-2), -32768, 32767))
+	i++
+	level = byte(RangeCheck(int64(int16(level)+1), 0, 255))
+	board[ix-1]++
+	counts[0] = 0
+	levels[Blue-1] = level
+	levels[color-1] = 0
+	chars['x'] = true
+	SetCell(ix, 0)
+	WriteLn(ix, " ", level, " ", levels[Blue-1], " ", chars['x'], " ", i)
+	letter = 'q'
+	digit = '7'
+	WriteLn(Chr(letter), Chr(digit))
+}
@@ -0,0 +1,20 @@
+// Integer arithmetic at Turbo Pascal's intermediate width, converted
+// with -tp-arith: intermediate results may overflow Integer, and are
+// narrowed where they're assigned or passed as arguments.
+package main
+
+var (
+	i, j int16
+	b    byte
+)
+
+func main() {
+	i = 20000
+	b = 200
+	j = int16(int32(i) * 3 / 4)
+	WriteLn(j)
+	j = int16(int32(b) * int32(b) / 100)
+	WriteLn(j)
+	i = 1000
+	WriteLn(Abs(int16(int32(i)*-3)), " ", Abs(int16(int32(i)*3-5000)))
+}
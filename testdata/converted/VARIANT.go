@@ -0,0 +1,171 @@
+// Variant records whose fields overlay each other, including a
+// nested variant part, a variant part without a tag field, and
+// fields of pointer and set types, which are accessed as bytes, and
+// typed constants of variant record types.
+package main
+
+type (
+	TShape uint8
+	TValue struct {
+		Color   byte
+		Kind    byte
+		variant [6]byte // variant part, see accessor methods
+	}
+	TFigure struct {
+		variant [6]byte // variant part, see accessor methods
+	}
+)
+
+const (
+	Circle TShape = iota + 1
+	Square
+)
+
+func (r *TValue) Ch() byte {
+	return r.variant[0]
+}
+
+func (r *TValue) SetCh(v byte) {
+	r.variant[0] = v
+}
+
+func (r *TValue) Attr() byte {
+	return r.variant[1]
+}
+
+func (r *TValue) SetAttr(v byte) {
+	r.variant[1] = v
+}
+
+func (r *TValue) W() uint16 {
+	return LoadUint16(r.variant[0:])
+}
+
+func (r *TValue) SetW(v uint16) {
+	StoreUint16(r.variant[0:], v)
+}
+
+func (r *TValue) L() int32 {
+	return int32(LoadUint32(r.variant[0:]))
+}
+
+func (r *TValue) SetL(v int32) {
+	StoreUint32(r.variant[0:], uint32(v))
+}
+
+func (r *TValue) Bytes(i int) byte {
+	return r.variant[i]
+}
+
+func (r *TValue) SetBytes(i int, v byte) {
+	r.variant[i] = v
+}
+
+func (r *TValue) Name() string {
+	return LoadString(r.variant[0:4])
+}
+
+func (r *TValue) SetName(v string) {
+	StoreString(r.variant[0:4], v)
+}
+
+// Next is of type ^Byte, so it's accessed as bytes
+func (r *TValue) Next() []byte {
+	return r.variant[0:4]
+}
+
+func (r *TValue) SetNext(v []byte) {
+	copy(r.variant[0:4], v)
+}
+
+// Flags is of type set of 0 .. 15, so it's accessed as bytes
+func (r *TValue) Flags() []byte {
+	return r.variant[4:6]
+}
+
+func (r *TValue) SetFlags(v []byte) {
+	copy(r.variant[4:6], v)
+}
+
+func (r *TFigure) Radius() float64 {
+	return LoadReal(r.variant[0:])
+}
+
+func (r *TFigure) SetRadius(v float64) {
+	StoreReal(r.variant[0:], v)
+}
+
+func (r *TFigure) Side() int16 {
+	return int16(LoadUint16(r.variant[0:]))
+}
+
+func (r *TFigure) SetSide(v int16) {
+	StoreUint16(r.variant[0:], uint16(v))
+}
+
+func (r *TFigure) Filled() bool {
+	return r.variant[2] != 0
+}
+
+func (r *TFigure) SetFilled(v bool) {
+	r.variant[2] = byte(BoolToInt(v))
+}
+
+func (r *TFigure) Pattern() byte {
+	return r.variant[3]
+}
+
+func (r *TFigure) SetPattern(v byte) {
+	r.variant[3] = v
+}
+
+var (
+	Quad   TValue    = TValue{Color: 1, Kind: 3}
+	Disc   TFigure   = TFigure{}
+	Values [2]TValue = [2]TValue{{Color: 2, Kind: 2}, {Color: 3, Kind: 0}}
+)
+
+func init() {
+	Quad.SetBytes(0, 1)
+	Quad.SetBytes(1, 2)
+	Quad.SetBytes(2, 3)
+	Quad.SetBytes(3, 4)
+	Disc.SetRadius(2.5)
+	Values[0].SetL(100)
+	Values[1].SetCh('x')
+	Values[1].SetAttr(7)
+}
+func ShowSquare() {
+	var Sq TFigure = TFigure{}
+	Sq.SetSide(4)
+	Sq.SetFilled(true)
+	Sq.SetPattern(9)
+	WriteLn(Sq.Side(), " ", Sq.Pattern())
+}
+
+var (
+	value  TValue
+	figure TFigure
+	i      int16
+)
+
+func main() {
+	value.Kind = 2
+	value.SetL(0x12345678)
+	for i = 0; i <= 3; i++ {
+		value.SetBytes(int(i), byte(int16(value.Bytes(int(i)))+1))
+	}
+	value.SetW(value.W() + 1)
+	value.SetCh('A')
+	value.SetAttr(0x1F)
+	i = int16(value.W())
+	value.SetName("abc")
+	figure.SetRadius(1.5)
+	figure.SetFilled(true)
+	if figure.Side() > 0 {
+		figure.SetPattern(1)
+	}
+	WriteLn(value.Kind, " ", Ord(value.Ch()), " ", value.Attr(), " ", i, " ", value.Name(), " ", figure.Side())
+	WriteLn(Quad.W(), " ", Disc.Radius(), " ", Values[0].L(), " ", Chr(Values[1].Ch()), Values[1].Attr())
+	ShowSquare()
+}
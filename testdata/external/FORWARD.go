@@ -0,0 +1,7 @@
+package main
+
+// The external routines of FORWARD.PAS
+
+func CheckSum(buf *int16, size uint16) uint16 {
+	return uint16(*buf) * size
+}